@@ -0,0 +1,44 @@
+package common
+
+// StringSet is a set of strings that keeps the order in which they were
+// first added. The zero value is not usable, create one with NewStringSet.
+type StringSet struct {
+	items []string
+	index map[string]struct{}
+}
+
+// NewStringSet returns a set holding the given strings without duplicates.
+func NewStringSet(items ...string) *StringSet {
+	s := &StringSet{index: make(map[string]struct{})}
+	for _, item := range items {
+		s.Add(item)
+	}
+	return s
+}
+
+// Add inserts a string and reports whether it was not in the set yet.
+func (s *StringSet) Add(item string) bool {
+	if _, ok := s.index[item]; ok {
+		return false
+	}
+	s.index[item] = struct{}{}
+	s.items = append(s.items, item)
+	return true
+}
+
+// Contains reports whether a string is in the set.
+func (s *StringSet) Contains(item string) bool {
+	_, ok := s.index[item]
+	return ok
+}
+
+// Len returns the number of strings in the set.
+func (s *StringSet) Len() int {
+	return len(s.items)
+}
+
+// Slice returns the strings in insertion order. The slice is shared with
+// the set and must not be modified.
+func (s *StringSet) Slice() []string {
+	return s.items
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_StringSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		add    []string
+		expect []string
+	}{
+		{"empty", nil, nil},
+		{"unique", []string{"b", "a", "c"}, []string{"b", "a", "c"}},
+		{"duplicates", []string{"b", "a", "b", "c", "a"}, []string{"b", "a", "c"}},
+		{"empty string", []string{"", "a", ""}, []string{"", "a"}},
+	}
+	for _, test := range tests {
+		s := NewStringSet()
+		added := 0
+		for _, item := range test.add {
+			if s.Add(item) {
+				added++
+			}
+		}
+		if !reflect.DeepEqual(s.Slice(), test.expect) {
+			t.Errorf("%s: expect %v, got %v", test.name, test.expect, s.Slice())
+		}
+		if s.Len() != len(test.expect) || added != len(test.expect) {
+			t.Errorf("%s: expect %d items, got %d with %d added", test.name, len(test.expect), s.Len(), added)
+		}
+		for _, item := range test.add {
+			if !s.Contains(item) {
+				t.Errorf("%s: expect set to contain %q", test.name, item)
+			}
+		}
+		if s.Contains("missing") {
+			t.Errorf("%s: unexpected item", test.name)
+		}
+	}
+}
+
+func Test_NewStringSet(t *testing.T) {
+	s := NewStringSet("x", "y", "x")
+	if !reflect.DeepEqual(s.Slice(), []string{"x", "y"}) {
+		t.Errorf("unexpected items %v", s.Slice())
+	}
+}
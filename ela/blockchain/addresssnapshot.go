@@ -0,0 +1,146 @@
+package blockchain
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/common"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	. "github.com/elastos/Elastos.ELA/blockchain"
+	common2 "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// addressCounter folds the history rows of an address into a value that is
+// stored at every height the address is active. Rolling a block back only
+// has to delete the values stored at its height.
+type addressCounter interface {
+	add(txh *types.TransactionHistory)
+	Serialize(w io.Writer) error
+	Deserialize(r io.Reader) error
+}
+
+// persistAddressSnapshots adds the rows of a block to the last value of
+// every address under the prefix, writes the results at the block height
+// and returns their keys.
+func (c ChainStoreExtend) persistAddressSnapshots(prefix DataEntryPrefix, block *Block,
+	txhs []types.TransactionHistory, newCounter func() addressCounter) ([][]byte, error) {
+	addresses := common.NewStringSet()
+	rows := make(map[string][]*types.TransactionHistory)
+	for i := range txhs {
+		addresses.Add(txhs[i].Address)
+		rows[txhs[i].Address] = append(rows[txhs[i].Address], &txhs[i])
+	}
+
+	var keys [][]byte
+	for _, address := range addresses.Slice() {
+		addrPrefix, err := addressSnapshotPrefix(prefix, address)
+		if err != nil {
+			return nil, err
+		}
+		counter := newCounter()
+		if block.Height > 0 {
+			if _, err := c.getAddressSnapshot(addrPrefix, block.Height-1, counter); err != nil {
+				return nil, err
+			}
+		}
+		for _, txh := range rows[address] {
+			counter.add(txh)
+		}
+		key := heightKey(addrPrefix, block.Height)
+		value := new(bytes.Buffer)
+		if err := counter.Serialize(value); err != nil {
+			return nil, err
+		}
+		c.BatchPut(key, value.Bytes())
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// getAddressSnapshot loads the last value at or below the height into the
+// counter. It reports false when the address had no activity by then.
+func (c ChainStoreExtend) getAddressSnapshot(addrPrefix []byte, height uint32, counter addressCounter) (bool, error) {
+	iter := c.NewIterator(addrPrefix)
+	defer iter.Release()
+	if !seekDescending(iter, addrPrefix, nil, height) {
+		return false, nil
+	}
+	if err := counter.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// migrateAddressSnapshots builds the values under the prefix from the
+// history rows. The rows are stored by address and then height, so one
+// address is folded completely before the next one starts.
+func (c ChainStoreExtend) migrateAddressSnapshots(prefix DataEntryPrefix, newCounter func() addressCounter) error {
+	iter := c.NewIterator([]byte{byte(DataTxHistoryPrefix)})
+	defer iter.Release()
+	var current *types.TransactionHistory
+	var counter addressCounter
+	count := 0
+	heights := make(map[uint32][][]byte)
+	c.NewBatch()
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		addrPrefix, err := addressSnapshotPrefix(prefix, current.Address)
+		if err != nil {
+			return err
+		}
+		value := new(bytes.Buffer)
+		if err := counter.Serialize(value); err != nil {
+			return err
+		}
+		key := heightKey(addrPrefix, uint32(current.Height))
+		c.BatchPut(key, value.Bytes())
+		heights[uint32(current.Height)] = append(heights[uint32(current.Height)], key)
+		count++
+		if count%migrateBatchSize == 0 {
+			if err := c.commitMigratedHeights(heights); err != nil {
+				return err
+			}
+			heights = make(map[uint32][][]byte)
+			c.NewBatch()
+		}
+		return nil
+	}
+	for iter.Next() {
+		txh, err := decodeTxHistory(iter.Value())
+		if err != nil {
+			return err
+		}
+		if current == nil || txh.Address != current.Address || txh.Height != current.Height {
+			if err := flush(); err != nil {
+				return err
+			}
+			if current == nil || txh.Address != current.Address {
+				counter = newCounter()
+			}
+			current = txh
+		}
+		counter.add(txh)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := c.commitMigratedHeights(heights); err != nil {
+		return err
+	}
+	log.Infof("%d entries under prefix 0x%x built from transaction history", count, byte(prefix))
+	return nil
+}
+
+// key: prefix + address + height
+func addressSnapshotPrefix(prefix DataEntryPrefix, address string) ([]byte, error) {
+	key := new(bytes.Buffer)
+	key.WriteByte(byte(prefix))
+	if err := common2.WriteVarString(key, address); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
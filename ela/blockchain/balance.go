@@ -0,0 +1,187 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	common2 "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+)
+
+// BalanceSnapshot is the balance of an address after the block at Height,
+// the last block that changed it.
+type BalanceSnapshot struct {
+	Height     uint32
+	CreateTime uint64
+	Balance    uint64
+}
+
+func newBalanceSnapshot() addressCounter {
+	return new(BalanceSnapshot)
+}
+
+func (b *BalanceSnapshot) add(txh *types.TransactionHistory) {
+	balance := int64(b.Balance) + balanceDelta(txh)
+	if balance < 0 {
+		log.Warnf("balance of %s below zero at height %d, the index is incomplete", txh.Address, txh.Height)
+		balance = 0
+	}
+	b.Balance = uint64(balance)
+	b.Height = uint32(txh.Height)
+	b.CreateTime = txh.CreateTime
+}
+
+// Serialize writes the balance and the block timestamp, the height is part
+// of the key.
+func (b *BalanceSnapshot) Serialize(w io.Writer) error {
+	if err := common2.WriteUint64(w, b.Balance); err != nil {
+		return err
+	}
+	return common2.WriteUint64(w, b.CreateTime)
+}
+
+func (b *BalanceSnapshot) Deserialize(r io.Reader) error {
+	var err error
+	if b.Balance, err = common2.ReadUint64(r); err != nil {
+		return err
+	}
+	b.CreateTime, err = common2.ReadUint64(r)
+	return err
+}
+
+// GetBalanceAt returns the last balance snapshot of an address at or below
+// the height. It reports false when the address had no activity by then.
+func (c ChainStoreExtend) GetBalanceAt(address string, height uint32) (*BalanceSnapshot, bool, error) {
+	if indexed, ok := c.getIndexedHeight(); !ok || height > indexed {
+		return nil, false, errors.New("height not indexed yet")
+	}
+	prefix, err := balancePrefix(address)
+	if err != nil {
+		return nil, false, err
+	}
+	return c.getBalanceAt(prefix, height)
+}
+
+// GetBalanceAtTime returns the last balance snapshot of an address at the
+// last indexed block created at or before the unix time. The height of that
+// block is found by a binary search over the block headers, then the balance
+// is read like GetBalanceAt. It reports false when the address had no
+// activity by then.
+func (c ChainStoreExtend) GetBalanceAtTime(address string, time uint64) (*BalanceSnapshot, bool, error) {
+	indexed, ok := c.getIndexedHeight()
+	if !ok {
+		return nil, false, errors.New("height not indexed yet")
+	}
+	height, ok, err := c.heightAtTime(time, indexed)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return c.GetBalanceAt(address, height)
+}
+
+// heightAtTime returns the last height up to the given one whose block was
+// created at or before the unix time, block times rising with the height.
+// It reports false when the first block is newer than the time.
+func (c ChainStoreExtend) heightAtTime(time uint64, to uint32) (uint32, bool, error) {
+	// lo ends at the first height whose block is newer than the time
+	lo, hi := uint64(0), uint64(to)+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		hash, err := c.GetBlockHash(uint32(mid))
+		if err != nil {
+			return 0, false, err
+		}
+		header, err := c.GetHeader(hash)
+		if err != nil {
+			return 0, false, err
+		}
+		if uint64(header.Timestamp) <= time {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return 0, false, nil
+	}
+	return uint32(lo - 1), true, nil
+}
+
+// GetBalanceSeries returns the balance of an address at FromHeight followed
+// by every change up to ToHeight, at most limit snapshots.
+func (c ChainStoreExtend) GetBalanceSeries(address string, from, to, limit uint32) ([]BalanceSnapshot, error) {
+	prefix, err := balancePrefix(address)
+	if err != nil {
+		return nil, err
+	}
+	series := make([]BalanceSnapshot, 0)
+	if from > 0 {
+		opening, ok, err := c.getBalanceAt(prefix, from-1)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			series = append(series, *opening)
+		}
+	}
+
+	iter := c.NewIterator(prefix)
+	defer iter.Release()
+	for ok := iter.Seek(heightKey(prefix, from)); ok; ok = iter.Next() {
+		if limit > 0 && uint32(len(series)) == limit {
+			break
+		}
+		snapshot, err := decodeBalanceSnapshot(prefix, iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if snapshot.Height > to {
+			break
+		}
+		series = append(series, *snapshot)
+	}
+	return series, nil
+}
+
+func (c ChainStoreExtend) getBalanceAt(prefix []byte, height uint32) (*BalanceSnapshot, bool, error) {
+	iter := c.NewIterator(prefix)
+	defer iter.Release()
+	if !seekDescending(iter, prefix, nil, height) {
+		return nil, false, nil
+	}
+	snapshot, err := decodeBalanceSnapshot(prefix, iter.Key(), iter.Value())
+	if err != nil {
+		return nil, false, err
+	}
+	return snapshot, true, nil
+}
+
+// key: DataBalancePrefix + address + height
+// value: balance + block timestamp
+func balancePrefix(address string) ([]byte, error) {
+	return addressSnapshotPrefix(DataBalancePrefix, address)
+}
+
+// balanceDelta is the change a history row makes to the balance of its
+// address.
+func balanceDelta(txh *types.TransactionHistory) int64 {
+	if txh.Type == SPEND {
+		return -int64(txh.Value)
+	}
+	return int64(txh.Value)
+}
+
+func decodeBalanceSnapshot(prefix, key, value []byte) (*BalanceSnapshot, error) {
+	if len(key) != len(prefix)+4 {
+		return nil, errors.New("invalid balance key")
+	}
+	snapshot := new(BalanceSnapshot)
+	if err := snapshot.Deserialize(bytes.NewReader(value)); err != nil {
+		return nil, err
+	}
+	snapshot.Height = binary.BigEndian.Uint32(key[len(prefix):])
+	return snapshot, nil
+}
@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_BalanceSnapshots(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	miner, _ := testAddress(3)
+
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 300), testOutput(alice, 690))
+	payBack := testTransfer([]*types2.Input{testInput(pay, 0)}, testOutput(alice, 295))
+	txs := []*types2.Transaction{
+		coinbase,
+		pay,
+		testCoinbase(2, testOutput(miner, 10)),
+		payBack,
+	}
+	var blocks []*types2.Block
+	for h, tx := range txs {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	tests := []struct {
+		addr    string
+		height  uint32
+		balance uint64
+		found   bool
+	}{
+		{aliceAddr, 0, 1000, true},
+		{aliceAddr, 1, 690, true},
+		{aliceAddr, 2, 690, true},
+		{aliceAddr, 3, 985, true},
+		{bobAddr, 0, 0, false},
+		{bobAddr, 2, 300, true},
+		{bobAddr, 3, 0, true},
+	}
+	for _, test := range tests {
+		snapshot, ok, err := c.GetBalanceAt(test.addr, test.height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.found || (ok && snapshot.Balance != test.balance) {
+			t.Errorf("%s at height %d: expect %d %v, got %+v %v", test.addr, test.height, test.balance, test.found, snapshot, ok)
+		}
+	}
+	if _, _, err := c.GetBalanceAt(aliceAddr, 4); err == nil {
+		t.Error("expect a height above the index to be rejected")
+	}
+
+	snapshot, ok, err := c.GetBalanceAtTime(aliceAddr, uint64(blocks[2].Header.Timestamp))
+	if err != nil || !ok || snapshot.Height != 1 || snapshot.Balance != 690 {
+		t.Errorf("unexpected balance by time %+v %v %v", snapshot, ok, err)
+	}
+	if _, ok, _ := c.GetBalanceAtTime(aliceAddr, uint64(blocks[0].Header.Timestamp)-1); ok {
+		t.Error("expect no balance before the first block")
+	}
+	for h, b := range blocks {
+		snapshot, ok, err := c.GetBalanceAtTime(aliceAddr, uint64(b.Header.Timestamp)+1)
+		if expect, _, _ := c.GetBalanceAt(aliceAddr, uint32(h)); err != nil || !ok || *snapshot != *expect {
+			t.Errorf("expect the balance at height %d by its time, got %+v %v %v", h, snapshot, ok, err)
+		}
+	}
+	// a block of the chain not indexed yet is not read
+	late := testBlock(4, testCoinbase(4, testOutput(alice, 5)))
+	chain.connect(late)
+	snapshot, ok, err = c.GetBalanceAtTime(aliceAddr, uint64(late.Header.Timestamp))
+	if err != nil || !ok || snapshot.Height != 3 || snapshot.Balance != 985 {
+		t.Errorf("expect the balance at the indexed height, got %+v %v %v", snapshot, ok, err)
+	}
+
+	series, err := c.GetBalanceSeries(aliceAddr, 2, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var points [][2]uint64
+	for _, s := range series {
+		points = append(points, [2]uint64{uint64(s.Height), s.Balance})
+	}
+	if expect := [][2]uint64{{1, 690}, {3, 985}}; !reflect.DeepEqual(points, expect) {
+		t.Errorf("expect series %v, got %v", expect, points)
+	}
+	if series, _ := c.GetBalanceSeries(aliceAddr, 0, 3, 2); len(series) != 2 {
+		t.Errorf("expect the series to be limited, got %+v", series)
+	}
+
+	if err := c.rollbackTxHistory(blocks[3]); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, _, _ := c.GetBalanceAt(aliceAddr, 2); snapshot.Balance != 690 {
+		t.Errorf("expect the balance to be rolled back to 690, got %d", snapshot.Balance)
+	}
+	if series, _ := c.GetBalanceSeries(bobAddr, 0, 10, 0); len(series) != 1 {
+		t.Errorf("expect bob's last change to be rolled back, got %+v", series)
+	}
+}
@@ -2,54 +2,215 @@ package blockchain
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
 	"github.com/elastos/Elastos.ELA/common"
-	"github.com/elastos/tmp/Elastos.ELA/log"
-	"os"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"io"
+)
+
+const (
+	txidLength = 32
+
+	roleIncome byte = 0x00
+	roleSpend  byte = 0x01
 )
 
 func (c ChainStoreExtend) begin() {
 	c.NewBatch()
 }
 
-func (c ChainStoreExtend) commit() {
-	c.BatchCommit()
+func (c ChainStoreExtend) commit() error {
+	return c.BatchCommit()
 }
 
+// rollback discards the writes of the open batch, starting a new batch
+// drops the old one.
 func (c ChainStoreExtend) rollback() {
-	c.rollback()
+	c.NewBatch()
 }
 
-// key: DataEntryPrefix + height + address
+// key: DataTxHistoryPrefix + address + height + txid + role
 // value: serialized history
-func (c ChainStoreExtend) persistTransactionHistory(txhs []types.TransactionHistory) error {
+// Nothing is written unless every entry of the block is.
+func (c ChainStoreExtend) persistTransactionHistory(block *Block, txhs []types.TransactionHistory) error {
 	c.begin()
+	keys, err := c.persistBlockEntries(block, txhs)
+	if err != nil {
+		c.rollback()
+		return err
+	}
+	if err := c.persistHeightIndex(block.Height, keys); err != nil {
+		c.rollback()
+		return fmt.Errorf("persist height index: %s", err)
+	}
+	c.batchTxHistory(txhs)
+	c.persistIndexedHeight(block.Height)
+	c.BatchDelete(quarantineKey(block.Height))
+	if err := c.commit(); err != nil {
+		c.rollback()
+		return fmt.Errorf("commit transaction history: %s", err)
+	}
+	c.cacheOutputs(block)
+	c.promotePending(block)
+	c.notifyTxHistory(txhs)
+	return nil
+}
+
+// persistBlockEntries writes every entry derived from a block to the open
+// batch and returns their keys.
+func (c ChainStoreExtend) persistBlockEntries(block *Block, txhs []types.TransactionHistory) ([][]byte, error) {
+	var keys [][]byte
 	for _, txh := range txhs {
-		err := c.doPersistTransactionHistory(txh)
+		key, err := c.doPersistTransactionHistory(txh)
 		if err != nil {
-			c.rollback()
-			log.Fatal("Error persist transaction history")
-			os.Exit(-1)
+			return nil, fmt.Errorf("persist transaction history of %s: %s", txh.Txid, err)
 		}
+		keys = append(keys, key)
 	}
-	c.commit()
-	return nil
+	crossChainKeys, err := c.persistCrossChainRecords(block)
+	if err != nil {
+		return nil, fmt.Errorf("persist cross chain records: %s", err)
+	}
+	keys = append(keys, crossChainKeys...)
+	balanceKeys, err := c.persistAddressSnapshots(DataBalancePrefix, block, txhs, newBalanceSnapshot)
+	if err != nil {
+		return nil, fmt.Errorf("persist balances: %s", err)
+	}
+	keys = append(keys, balanceKeys...)
+	summaryKeys, err := c.persistAddressSnapshots(DataAddressSummaryPrefix, block, txhs, newAddressSummary)
+	if err != nil {
+		return nil, fmt.Errorf("persist address summaries: %s", err)
+	}
+	keys = append(keys, summaryKeys...)
+	spentKeys, err := c.persistSpentOutputs(block)
+	if err != nil {
+		return nil, fmt.Errorf("persist spent outputs: %s", err)
+	}
+	keys = append(keys, spentKeys...)
+	if err := c.updateRichList(block, txhs); err != nil {
+		return nil, fmt.Errorf("persist rich list: %s", err)
+	}
+	return keys, nil
 }
 
-func (c ChainStoreExtend) doPersistTransactionHistory(history types.TransactionHistory) error {
+func (c ChainStoreExtend) doPersistTransactionHistory(history types.TransactionHistory) ([]byte, error) {
+	key, err := txHistoryKey(history)
+	if err != nil {
+		return nil, err
+	}
+	value := new(bytes.Buffer)
+	err = history.Serialize(value)
+	if err != nil {
+		return nil, err
+	}
+	c.BatchPut(key, value.Bytes())
+	return key, nil
+}
+
+// txHistoryKey builds the key of a history row. The height is big endian so
+// the rows of an address are iterated in block order, and the txid and role
+// keep the rows of different transactions in the same block apart.
+func txHistoryKey(history types.TransactionHistory) ([]byte, error) {
 	key := new(bytes.Buffer)
 	key.WriteByte(byte(DataTxHistoryPrefix))
 	err := common.WriteVarString(key, history.Address)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var height [4]byte
+	binary.BigEndian.PutUint32(height[:], uint32(history.Height))
+	key.Write(height[:])
+	txid, err := hex.DecodeString(history.Txid)
+	if err != nil || len(txid) != txidLength {
+		return nil, errors.New("invalid txid " + history.Txid)
 	}
-	err = common.WriteUint64(key, history.Height)
+	key.Write(txid)
+	switch history.Type {
+	case INCOME:
+		key.WriteByte(roleIncome)
+	case SPEND:
+		key.WriteByte(roleSpend)
+	default:
+		return nil, errors.New("invalid history type " + history.Type)
+	}
+	return key.Bytes(), nil
+}
+
+// key: DataHeightIndexPrefix + height
+// value: keys of every row written for the block at that height
+func (c ChainStoreExtend) persistHeightIndex(height uint32, keys [][]byte) error {
+	value := new(bytes.Buffer)
+	err := common.WriteVarUint(value, uint64(len(keys)))
 	if err != nil {
 		return err
 	}
+	for _, k := range keys {
+		err = common.WriteVarUint(value, uint64(len(k)))
+		if err != nil {
+			return err
+		}
+		_, err = value.Write(k)
+		if err != nil {
+			return err
+		}
+	}
+	c.BatchPut(heightIndexKey(height), value.Bytes())
+	return nil
+}
 
+func (c ChainStoreExtend) getHeightIndex(height uint32) ([][]byte, error) {
+	data, err := c.Get(heightIndexKey(height))
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	n, err := common.ReadVarUint(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, 0, n)
+	for i := uint64(0); i < n; i++ {
+		l, err := common.ReadVarUint(r, 0)
+		if err != nil {
+			return nil, err
+		}
+		k := make([]byte, l)
+		_, err = io.ReadFull(r, k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func heightIndexKey(height uint32) []byte {
+	key := make([]byte, 5)
+	key[0] = byte(DataHeightIndexPrefix)
+	binary.BigEndian.PutUint32(key[1:], height)
+	return key
+}
+
+// key: DataIndexedHeightPrefix
+// value: height of the last block whose history has been persisted
+func (c ChainStoreExtend) persistIndexedHeight(height uint32) {
 	value := new(bytes.Buffer)
-	history.Serialize(value)
-	c.BatchPut(key.Bytes(), value.Bytes())
-	return nil
+	common.WriteUint32(value, height)
+	c.BatchPut([]byte{byte(DataIndexedHeightPrefix)}, value.Bytes())
+}
+
+func (c ChainStoreExtend) getIndexedHeight() (uint32, bool) {
+	data, err := c.Get([]byte{byte(DataIndexedHeightPrefix)})
+	if err != nil {
+		return 0, false
+	}
+	height, err := common.ReadUint32(bytes.NewReader(data))
+	if err != nil {
+		return 0, false
+	}
+	return height, true
 }
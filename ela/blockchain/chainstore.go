@@ -7,10 +7,9 @@ import (
 	. "github.com/elastos/Elastos.ELA/blockchain"
 	"github.com/elastos/Elastos.ELA/common/log"
 	. "github.com/elastos/Elastos.ELA/core/types"
-	"github.com/elastos/Elastos.ELA/core/types/payload"
 	common2 "github.com/xiaomingfuckeasylife/Elastos.ELA/common"
+	"math"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 )
@@ -18,6 +17,7 @@ import (
 const (
 	INCOME      string = "income"
 	SPEND       string = "spend"
+	VOTE        string = "Vote"
 	MINING_ADDR string = "0000000000000000000000000000000000"
 	ELA         uint64 = 100000000
 )
@@ -32,18 +32,43 @@ var txTypeEnum = map[TransactionType]string{
 	RechargeToSideChain:     "RechargeToSideChain",
 	WithdrawFromSideChain:   "WithdrawFromSideChain",
 	TransferCrossChainAsset: "TransferCrossChainAsset",
+	RegisterProducer:        "RegisterProducer",
+	CancelProducer:          "CancelProducer",
+	UpdateProducer:          "UpdateProducer",
+	ReturnDepositCoin:       "ReturnDepositCoin",
 }
 
 type ChainStoreExtend struct {
 	IChainStore
 	IStore
-	taskChEx chan interface{}
-	quitEx   chan chan bool
-	mu       sync.Mutex
+	taskChEx  chan interface{}
+	quitEx    chan chan bool
+	mu        sync.Mutex
+	pending   *pendingTxHistory
+	listeners *historyListeners
+	verifier  *indexVerifier
+	workLog   *workLog
+	failure   *indexFailure
+	outputs   *outputCache
 }
 
+// AddTask hands work to the indexing loop. Saved and detached blocks are
+// written to the work log, so they are never lost and never wait for the
+// loop. Other tasks are queued in memory.
 func (c ChainStoreExtend) AddTask(task interface{}) {
-	c.taskChEx <- task
+	var err error
+	switch kind := task.(type) {
+	case *Block:
+		err = c.logBlock(kind)
+	case *RollbackTask:
+		err = c.logRollback(kind.Block)
+	default:
+		c.taskChEx <- task
+		return
+	}
+	if err != nil {
+		log.Error("work log: ", err)
+	}
 }
 
 func NewChainStoreEx(chainstore IChainStore, filePath string) (ChainStoreExtend, error) {
@@ -51,15 +76,30 @@ func NewChainStoreEx(chainstore IChainStore, filePath string) (ChainStoreExtend,
 	if err != nil {
 		return ChainStoreExtend{}, err
 	}
-	c := ChainStoreExtend{
+	c := newChainStoreEx(chainstore, st)
+	err = c.checkSchemaVersion()
+	if err != nil {
+		st.Close()
+		return ChainStoreExtend{}, err
+	}
+	DefaultChainStoreEx = c
+	go c.loop()
+	return c, nil
+}
+
+func newChainStoreEx(chainstore IChainStore, st IStore) ChainStoreExtend {
+	return ChainStoreExtend{
 		IChainStore: chainstore,
 		IStore:      st,
 		taskChEx:    make(chan interface{}, TaskChanCap),
 		quitEx:      make(chan chan bool, 1),
+		pending:     newPendingTxHistory(),
+		listeners:   new(historyListeners),
+		verifier:    newIndexVerifier(),
+		workLog:     newWorkLog(),
+		failure:     newIndexFailure(),
+		outputs:     newOutputCache(outputCacheSize),
 	}
-	DefaultChainStoreEx = c
-	go c.loop()
-	return c, nil
 }
 
 func (c ChainStoreExtend) Close() {
@@ -67,164 +107,177 @@ func (c ChainStoreExtend) Close() {
 }
 
 func (c ChainStoreExtend) persistTxHistory(block *Block) error {
+	txhs, err := c.blockTxHistory(block, c.outputs)
+	if err != nil {
+		return err
+	}
+	return c.persistTransactionHistory(block, txhs)
+}
+
+// blockTxHistory builds the rows of every transaction of a block. The spent
+// outputs are looked up in outputs when it is not nil.
+func (c ChainStoreExtend) blockTxHistory(block *Block, outputs *outputCache) ([]types.TransactionHistory, error) {
 	txs := block.Transactions
 	txhs := make([]types.TransactionHistory, 0)
 	for i := 0; i < len(txs); i++ {
 		tx := txs[i]
 		if tx.TxType == CoinBase {
-			vouts := txs[i].Outputs
-			var to []string
-			hold := make(map[string]types.TransactionHistory)
-			for _, vout := range vouts {
-				address, _ := vout.ProgramHash.ToAddress()
-				if !common.Contains(address, to) {
-					to = append(to, address)
-					txh := types.TransactionHistory{}
-					txh.Value = uint64(vout.Value)
-					txh.Address = address
-					txh.Inputs = []string{MINING_ADDR}
-					txh.TxType = txTypeEnum[tx.TxType]
-					txh.Txid, _ = common.ReverseHexString(tx.Hash().String())
-					txh.Height = uint64(block.Height)
-					txh.CreateTime = uint64(block.Header.Timestamp)
-					txh.Type = INCOME
-					txh.Fee = 0
-					txhs = append(txhs, txh)
-				} else {
-					txh := hold[address]
-					txh.Value += uint64(vout.Value)
-				}
-			}
-			for _, txh := range txhs {
-				txh.Outputs = to
-			}
+			txhs = append(txhs, coinbaseTxHistory(block, tx)...)
 		} else {
-			isCrossTx := false
-			if tx.TxType == TransferCrossChainAsset {
-				isCrossTx = true
-			}
-			spend := make(map[string]int64)
-			var totalInput int64 = 0
-			var from []string
-			var to []string
-			for _, input := range tx.Inputs {
-				txid := input.Previous.TxID
-				index := input.Previous.Index
-				//txResp, err := get("http://" + config.Conf.Ela.Host + TransactionDetail + vintxid)
-				referTx, _, err := c.GetTransaction(txid)
-				if err != nil {
-					return err
-				}
-				address, _ := referTx.Outputs[index].ProgramHash.ToAddress()
-				totalInput += int64(referTx.Outputs[index].Value)
-				v, ok := spend[address]
-				if ok {
-					spend[address] = v + int64(referTx.Outputs[index].Value)
-				} else {
-					spend[address] = int64(referTx.Outputs[index].Value)
-				}
-				if !common.Contains(address, from) {
-					from = append(from, address)
-				}
-			}
-			receive := make(map[string]int64)
-			var totalOutput int64 = 0
-			for _, output := range tx.Outputs {
-				address, _ := output.ProgramHash.ToAddress()
-				var valueCross int64
-				if isCrossTx == true && (address == MINING_ADDR || strings.Index(address, "X") == 0) {
-					switch pl := tx.Payload.(type) {
-					case *payload.PayloadTransferCrossChainAsset:
-						valueCross = int64(pl.CrossChainAmounts[0])
-					}
-				}
-				if valueCross != 0 {
-					totalOutput += valueCross
-				} else {
-					totalOutput += int64(output.Value)
-				}
-				v, ok := receive[address]
-				if ok {
-					receive[address] = v + int64(output.Value)
-				} else {
-					receive[address] = int64(output.Value)
-				}
-				if !common.Contains(address, to) {
-					to = append(to, address)
-				}
-			}
-			fee := totalInput - totalOutput
-			for k, r := range receive {
-				transferType := INCOME
-				s, ok := spend[k]
-				var value int64
-				if ok {
-					if s > r {
-						value = s - r
-						transferType = SPEND
-					} else {
-						value = r - s
-					}
-					delete(spend, k)
-				} else {
-					value = r
-				}
-				var realFee uint64 = uint64(fee)
-				if transferType == INCOME {
-					realFee = 0
-				}
-				txh := types.TransactionHistory{}
-				txh.Value = uint64(value)
-				txh.Address = k
-				txh.Inputs = from
-				txh.TxType = txTypeEnum[tx.TxType]
-				txh.Txid, _ = common.ReverseHexString(tx.Hash().String())
-				txh.Height = uint64(block.Height)
-				txh.CreateTime = uint64(block.Header.Timestamp)
-				txh.Type = transferType
-				txh.Fee = realFee
-				txh.Outputs = to
-				txhs = append(txhs, txh)
+			rows, err := c.transferTxHistory(tx, block.Height, uint64(block.Header.Timestamp), nil, outputs)
+			if err != nil {
+				return nil, err
 			}
+			txhs = append(txhs, rows...)
+		}
+	}
+	return txhs, nil
+}
 
-			for k, r := range spend {
-				txh := types.TransactionHistory{}
-				txh.Value = uint64(r)
-				txh.Address = k
-				txh.Inputs = from
-				txh.TxType = txTypeEnum[tx.TxType]
-				txh.Txid, _ = common.ReverseHexString(tx.Hash().String())
-				txh.Height = uint64(block.Height)
-				txh.CreateTime = uint64(block.Header.Timestamp)
-				txh.Type = SPEND
-				txh.Fee = uint64(fee)
-				txh.Outputs = to
-				txhs = append(txhs, txh)
+// transferTxHistory builds the rows of a transaction that is not a coinbase.
+// The outputs spent by its inputs are looked up in pool before outputs and
+// the chain.
+func (c ChainStoreExtend) transferTxHistory(tx *Transaction, height uint32, createTime uint64, pool txPool, outputs *outputCache) ([]types.TransactionHistory, error) {
+	memo := txMemo(tx)
+	txType := txTypeName(tx)
+	txhs := make([]types.TransactionHistory, 0)
+	crossChainAmounts := crossChainOutputAmounts(tx)
+	dpos := newDposInfo(tx)
+	spend := make(map[string]int64)
+	var totalInput int64 = 0
+	from := common.NewStringSet()
+	to := common.NewStringSet()
+	for _, input := range tx.Inputs {
+		//txResp, err := get("http://" + config.Conf.Ela.Host + TransactionDetail + vintxid)
+		referOutput, err := c.referOutput(input.Previous, pool, outputs)
+		if err != nil {
+			return nil, err
+		}
+		address, _ := referOutput.ProgramHash.ToAddress()
+		dpos.addInput(tx, referOutput)
+		totalInput += int64(referOutput.Value)
+		v, ok := spend[address]
+		if ok {
+			spend[address] = v + int64(referOutput.Value)
+		} else {
+			spend[address] = int64(referOutput.Value)
+		}
+		from.Add(address)
+	}
+	receive := make(map[string]int64)
+	var totalOutput int64 = 0
+	for i, output := range tx.Outputs {
+		address, _ := output.ProgramHash.ToAddress()
+		if amount, ok := crossChainAmounts[i]; ok {
+			totalOutput += amount
+		} else {
+			totalOutput += int64(output.Value)
+		}
+		v, ok := receive[address]
+		if ok {
+			receive[address] = v + int64(output.Value)
+		} else {
+			receive[address] = int64(output.Value)
+		}
+		to.Add(address)
+	}
+	fee := totalInput - totalOutput
+	for k, r := range receive {
+		transferType := INCOME
+		s, ok := spend[k]
+		var value int64
+		if ok {
+			if s > r {
+				value = s - r
+				transferType = SPEND
+			} else {
+				value = r - s
 			}
+			delete(spend, k)
+		} else {
+			value = r
 		}
+		var realFee uint64 = uint64(fee)
+		if transferType == INCOME {
+			realFee = 0
+		}
+		txh := types.TransactionHistory{}
+		txh.Value = uint64(value)
+		txh.Address = k
+		txh.Inputs = from.Slice()
+		txh.TxType = txType
+		txh.Txid, _ = common.ReverseHexString(tx.Hash().String())
+		txh.Height = uint64(height)
+		txh.CreateTime = createTime
+		txh.Type = transferType
+		txh.Fee = realFee
+		txh.Outputs = to.Slice()
+		txh.Memo = memo
+		setCrossChainInfo(&txh, tx)
+		dpos.apply(&txh)
+		txhs = append(txhs, txh)
 	}
-	c.persistTransactionHistory(txhs)
-	return nil
+
+	for k, r := range spend {
+		txh := types.TransactionHistory{}
+		txh.Value = uint64(r)
+		txh.Address = k
+		txh.Inputs = from.Slice()
+		txh.TxType = txType
+		txh.Txid, _ = common.ReverseHexString(tx.Hash().String())
+		txh.Height = uint64(height)
+		txh.CreateTime = createTime
+		txh.Type = SPEND
+		txh.Fee = uint64(fee)
+		txh.Outputs = to.Slice()
+		txh.Memo = memo
+		setCrossChainInfo(&txh, tx)
+		dpos.apply(&txh)
+		txhs = append(txhs, txh)
+	}
+	return txhs, nil
 }
 
 func (c ChainStoreExtend) CloseEx() {
+	close(c.verifier.stop)
+	close(c.pending.stop)
 	closed := make(chan bool)
 	c.quitEx <- closed
 	<-closed
 }
 
 func (c ChainStoreExtend) loop() {
+	ticker := time.NewTicker(workPollInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case t := <-c.taskChEx:
 			now := time.Now()
 			switch kind := t.(type) {
-			case *Block:
-				c.persistTxHistory(kind)
+			case *ReindexTask:
+				if closed := c.reindex(kind); closed != nil {
+					closed <- true
+					return
+				}
+				tcall := float64(time.Now().Sub(now)) / float64(time.Second)
+				log.Debugf("handle Reindex time cost: %g", tcall)
+			case *repairTask:
+				if closed := c.repair(kind.report); closed != nil {
+					closed <- true
+					return
+				}
 				tcall := float64(time.Now().Sub(now)) / float64(time.Second)
-				log.Debugf("handle SaveHistory time cost: %g num transactions:%d", tcall, len(kind.Transactions))
+				log.Debugf("handle Repair time cost: %g", tcall)
 			}
+		case <-c.workLog.wake:
+		case <-ticker.C:
 		case closed := <-c.quitEx:
+			c.drainWorkLog()
+			closed <- true
+			return
+		}
+		if closed := c.processWorkLog(math.MaxUint32); closed != nil {
+			c.drainWorkLog()
 			closed <- true
 			return
 		}
@@ -2,9 +2,17 @@ package blockchain
 
 import (
 	"bytes"
+	"errors"
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
 	"github.com/elastos/Elastos.ELA/blockchain"
 	"github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/outputpayload"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"reflect"
 	"testing"
 )
 
@@ -71,3 +79,213 @@ func Test_GetTxHistory(t *testing.T) {
 		t.Log(v)
 	}
 }
+
+// memStore is an IStore backed by an in-memory LevelDB.
+type memStore struct {
+	db    *leveldb.DB
+	batch *leveldb.Batch
+}
+
+func newMemStore(t *testing.T) *memStore {
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &memStore{db: db}
+}
+
+func (s *memStore) Put(key []byte, value []byte) error { return s.db.Put(key, value, nil) }
+func (s *memStore) Get(key []byte) ([]byte, error)     { return s.db.Get(key, nil) }
+func (s *memStore) Delete(key []byte) error            { return s.db.Delete(key, nil) }
+func (s *memStore) NewBatch()                          { s.batch = new(leveldb.Batch) }
+func (s *memStore) BatchPut(key []byte, value []byte)  { s.batch.Put(key, value) }
+func (s *memStore) BatchDelete(key []byte)             { s.batch.Delete(key) }
+func (s *memStore) BatchCommit() error                 { return s.db.Write(s.batch, nil) }
+func (s *memStore) Close() error                       { return s.db.Close() }
+func (s *memStore) NewIterator(prefix []byte) blockchain.IIterator {
+	return s.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+// testChainStore is the part of the main chain store used by the indexer,
+// holding a single chain that can be extended and cut back.
+type testChainStore struct {
+	blockchain.IChainStore
+	blocks []*types2.Block
+	txs    map[common.Uint256]*types2.Transaction
+	// readErr fails the reads of blocks when set
+	readErr error
+}
+
+func newTestChainStore() *testChainStore {
+	return &testChainStore{txs: make(map[common.Uint256]*types2.Transaction)}
+}
+
+func (s *testChainStore) connect(block *types2.Block) {
+	s.blocks = append(s.blocks, block)
+	for _, tx := range block.Transactions {
+		s.txs[tx.Hash()] = tx
+	}
+}
+
+func (s *testChainStore) disconnect() *types2.Block {
+	block := s.blocks[len(s.blocks)-1]
+	s.blocks = s.blocks[:len(s.blocks)-1]
+	for _, tx := range block.Transactions {
+		delete(s.txs, tx.Hash())
+	}
+	return block
+}
+
+func (s *testChainStore) GetHeight() uint32 {
+	return uint32(len(s.blocks) - 1)
+}
+
+func (s *testChainStore) GetBlockHash(height uint32) (common.Uint256, error) {
+	if int(height) >= len(s.blocks) {
+		return common.Uint256{}, errors.New("block not found")
+	}
+	return s.blocks[height].Hash(), nil
+}
+
+func (s *testChainStore) GetBlock(hash common.Uint256) (*types2.Block, error) {
+	if s.readErr != nil {
+		return nil, s.readErr
+	}
+	for _, b := range s.blocks {
+		if b.Hash().IsEqual(hash) {
+			return b, nil
+		}
+	}
+	return nil, errors.New("block not found")
+}
+
+func (s *testChainStore) GetHeader(hash common.Uint256) (*types2.Header, error) {
+	block, err := s.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &block.Header, nil
+}
+
+func (s *testChainStore) GetTransaction(txID common.Uint256) (*types2.Transaction, uint32, error) {
+	tx, ok := s.txs[txID]
+	if !ok {
+		return nil, 0, leveldb.ErrNotFound
+	}
+	for _, b := range s.blocks {
+		for _, t := range b.Transactions {
+			if t == tx {
+				return tx, b.Height, nil
+			}
+		}
+	}
+	return tx, 0, nil
+}
+
+func (s *testChainStore) GetUnspentsFromProgramHash(programHash common.Uint168) (map[common.Uint256][]*types2.UTXO, error) {
+	spent := make(map[types2.OutPoint]bool)
+	for _, b := range s.blocks {
+		for _, tx := range b.Transactions {
+			for _, input := range tx.Inputs {
+				spent[input.Previous] = true
+			}
+		}
+	}
+	unspents := make(map[common.Uint256][]*types2.UTXO)
+	for _, b := range s.blocks {
+		for _, tx := range b.Transactions {
+			for i, output := range tx.Outputs {
+				if output.ProgramHash != programHash || spent[types2.OutPoint{TxID: tx.Hash(), Index: uint16(i)}] {
+					continue
+				}
+				unspents[output.AssetID] = append(unspents[output.AssetID],
+					&types2.UTXO{TxID: tx.Hash(), Index: uint32(i), Value: output.Value})
+			}
+		}
+	}
+	return unspents, nil
+}
+
+func testAddress(n byte) (common.Uint168, string) {
+	programHash := common.Uint168{0x21, n}
+	address, _ := programHash.ToAddress()
+	return programHash, address
+}
+
+func testOutput(programHash common.Uint168, value common.Fixed64) *types2.Output {
+	return &types2.Output{
+		Value:         value,
+		ProgramHash:   programHash,
+		OutputType:    types2.DefaultOutput,
+		OutputPayload: &outputpayload.DefaultOutput{},
+	}
+}
+
+func testCoinbase(height uint32, outputs ...*types2.Output) *types2.Transaction {
+	return &types2.Transaction{
+		TxType:   types2.CoinBase,
+		Payload:  &payload.PayloadCoinBase{},
+		LockTime: height,
+		Outputs:  outputs,
+	}
+}
+
+func testTransfer(inputs []*types2.Input, outputs ...*types2.Output) *types2.Transaction {
+	return &types2.Transaction{
+		TxType:  types2.TransferAsset,
+		Payload: &payload.PayloadTransferAsset{},
+		Inputs:  inputs,
+		Outputs: outputs,
+	}
+}
+
+func testInput(tx *types2.Transaction, index uint16) *types2.Input {
+	return &types2.Input{Previous: types2.OutPoint{TxID: tx.Hash(), Index: index}}
+}
+
+func testBlock(height uint32, txs ...*types2.Transaction) *types2.Block {
+	return &types2.Block{
+		Header: types2.Header{
+			Height:    height,
+			Timestamp: 1500000000 + height*120,
+			Nonce:     uint32(len(txs)),
+		},
+		Transactions: txs,
+	}
+}
+
+func Test_PersistTxHistoryDedupAddresses(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 100), testOutput(alice, 200))
+	transfer := testTransfer([]*types2.Input{testInput(coinbase, 0), testInput(coinbase, 1)},
+		testOutput(bob, 50), testOutput(bob, 50), testOutput(alice, 190))
+	for h, tx := range []*types2.Transaction{coinbase, transfer} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := NewTxHistoryQuery(bobAddr)
+	page, err := c.GetTxHistoryPage(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.History) != 1 {
+		t.Fatalf("expect one row, got %+v", page.History)
+	}
+	txh := page.History[0]
+	if !reflect.DeepEqual(txh.Inputs, []string{aliceAddr}) {
+		t.Errorf("expect inputs %v, got %v", []string{aliceAddr}, txh.Inputs)
+	}
+	if !reflect.DeepEqual(txh.Outputs, []string{bobAddr, aliceAddr}) {
+		t.Errorf("expect outputs %v, got %v", []string{bobAddr, aliceAddr}, txh.Outputs)
+	}
+	if txh.Value != 100 {
+		t.Errorf("expect bob to receive 100, got %d", txh.Value)
+	}
+}
@@ -0,0 +1,39 @@
+package blockchain
+
+import (
+	"github.com/elastos/Elastos.ELA.Elephant.Node/common"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// coinbaseTxHistory builds one income row for every address paid by a
+// coinbase transaction, in the order the addresses first appear. Outputs to
+// the same address are summed, and every row lists all paid addresses.
+func coinbaseTxHistory(block *Block, tx *Transaction) []types.TransactionHistory {
+	to := common.NewStringSet()
+	values := make(map[string]uint64)
+	for _, output := range tx.Outputs {
+		address, _ := output.ProgramHash.ToAddress()
+		to.Add(address)
+		values[address] += uint64(output.Value)
+	}
+
+	txid, _ := common.ReverseHexString(tx.Hash().String())
+	memo := txMemo(tx)
+	txhs := make([]types.TransactionHistory, 0, to.Len())
+	for _, address := range to.Slice() {
+		txhs = append(txhs, types.TransactionHistory{
+			Address:    address,
+			Txid:       txid,
+			Type:       INCOME,
+			Value:      values[address],
+			CreateTime: uint64(block.Header.Timestamp),
+			Height:     uint64(block.Height),
+			Inputs:     []string{MINING_ADDR},
+			Outputs:    to.Slice(),
+			TxType:     txTypeName(tx),
+			Memo:       memo,
+		})
+	}
+	return txhs
+}
@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	common2 "github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_CoinbaseTxHistory(t *testing.T) {
+	foundation := common2.Uint168{0x12, 1}
+	foundationAddr, _ := foundation.ToAddress()
+	miner, minerAddr := testAddress(1)
+	arbiter, arbiterAddr := testAddress(2)
+
+	type row struct {
+		addr  string
+		value uint64
+	}
+	tests := []struct {
+		name    string
+		outputs []*types2.Output
+		expect  []row
+	}{
+		{"no outputs", nil, nil},
+		{"miner only", []*types2.Output{testOutput(miner, 500)}, []row{{minerAddr, 500}}},
+		{"foundation and miner", []*types2.Output{
+			testOutput(foundation, 150), testOutput(miner, 350),
+		}, []row{{foundationAddr, 150}, {minerAddr, 350}}},
+		{"miner paid twice", []*types2.Output{
+			testOutput(foundation, 150), testOutput(miner, 175), testOutput(miner, 175),
+		}, []row{{foundationAddr, 150}, {minerAddr, 350}}},
+		{"interleaved", []*types2.Output{
+			testOutput(miner, 1), testOutput(arbiter, 2), testOutput(miner, 3), testOutput(arbiter, 4),
+		}, []row{{minerAddr, 4}, {arbiterAddr, 6}}},
+	}
+	for _, test := range tests {
+		tx := testCoinbase(7, test.outputs...)
+		txhs := coinbaseTxHistory(testBlock(7, tx), tx)
+		var got []row
+		var addrs []string
+		for _, txh := range txhs {
+			got = append(got, row{txh.Address, txh.Value})
+			addrs = append(addrs, txh.Address)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("%s: expect rows %v, got %v", test.name, test.expect, got)
+		}
+		for _, txh := range txhs {
+			if !reflect.DeepEqual(txh.Outputs, addrs) {
+				t.Errorf("%s: expect outputs %v, got %v", test.name, addrs, txh.Outputs)
+			}
+			if txh.Type != INCOME || txh.TxType != "CoinBase" || txh.Height != 7 ||
+				txh.Fee != 0 || len(txh.Inputs) != 1 || txh.Inputs[0] != MINING_ADDR {
+				t.Errorf("%s: unexpected row %+v", test.name, txh)
+			}
+		}
+	}
+}
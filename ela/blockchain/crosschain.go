@@ -0,0 +1,175 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/common"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	common2 "github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// crossChainOutputAmounts maps the index of every cross chain output of a
+// transaction to the amount that arrives on the side chain.
+func crossChainOutputAmounts(tx *Transaction) map[int]int64 {
+	pl, ok := tx.Payload.(*payload.PayloadTransferCrossChainAsset)
+	if !ok {
+		return nil
+	}
+	amounts := make(map[int]int64)
+	for i, index := range pl.OutputIndexes {
+		if i < len(pl.CrossChainAmounts) {
+			amounts[int(index)] += int64(pl.CrossChainAmounts[i])
+		}
+	}
+	return amounts
+}
+
+// setCrossChainInfo copies the cross chain metadata of a transaction into a
+// history row.
+func setCrossChainInfo(txh *types.TransactionHistory, tx *Transaction) {
+	switch pl := tx.Payload.(type) {
+	case *payload.PayloadTransferCrossChainAsset:
+		txh.CrossChainAddresses = pl.CrossChainAddresses
+		txh.CrossChainAmounts = make([]uint64, 0, len(pl.CrossChainAmounts))
+		for _, amount := range pl.CrossChainAmounts {
+			txh.CrossChainAmounts = append(txh.CrossChainAmounts, uint64(amount))
+		}
+	case *payload.PayloadWithdrawFromSideChain:
+		txh.SideChainTxids = make([]string, 0, len(pl.SideChainTransactionHashes))
+		for _, hash := range pl.SideChainTransactionHashes {
+			txid, _ := common.ReverseHexString(hash.String())
+			txh.SideChainTxids = append(txh.SideChainTxids, txid)
+		}
+	}
+}
+
+// persistCrossChainRecords writes the deposit and withdrawal records of a
+// block and returns their keys.
+func (c ChainStoreExtend) persistCrossChainRecords(block *Block) ([][]byte, error) {
+	var keys [][]byte
+	for _, tx := range block.Transactions {
+		txid, _ := common.ReverseHexString(tx.Hash().String())
+		record := types.CrossChainRecord{
+			Txid:       txid,
+			TxType:     txTypeEnum[tx.TxType],
+			Height:     uint64(block.Height),
+			CreateTime: uint64(block.Header.Timestamp),
+		}
+		switch pl := tx.Payload.(type) {
+		case *payload.PayloadTransferCrossChainAsset:
+			for i, address := range pl.CrossChainAddresses {
+				deposit := record
+				deposit.Address = address
+				if i < len(pl.CrossChainAmounts) {
+					deposit.Amount = uint64(pl.CrossChainAmounts[i])
+				}
+				key, err := crossChainDepositKey(address, block.Height, txid, uint16(i))
+				if err != nil {
+					return nil, err
+				}
+				if err := c.persistCrossChainRecord(key, &deposit); err != nil {
+					return nil, err
+				}
+				keys = append(keys, key)
+			}
+		case *payload.PayloadWithdrawFromSideChain:
+			for _, hash := range pl.SideChainTransactionHashes {
+				withdrawal := record
+				withdrawal.SideChainTxid, _ = common.ReverseHexString(hash.String())
+				key, err := crossChainWithdrawalKey(withdrawal.SideChainTxid)
+				if err != nil {
+					return nil, err
+				}
+				if err := c.persistCrossChainRecord(key, &withdrawal); err != nil {
+					return nil, err
+				}
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (c ChainStoreExtend) persistCrossChainRecord(key []byte, record *types.CrossChainRecord) error {
+	value := new(bytes.Buffer)
+	if err := record.Serialize(value); err != nil {
+		return err
+	}
+	c.BatchPut(key, value.Bytes())
+	return nil
+}
+
+// GetCrossChainDeposits returns the deposits made to a side chain address in
+// block order.
+func (c ChainStoreExtend) GetCrossChainDeposits(address string) ([]types.CrossChainRecord, error) {
+	prefix := new(bytes.Buffer)
+	prefix.WriteByte(byte(DataCrossChainDepositPrefix))
+	if err := common2.WriteVarString(prefix, address); err != nil {
+		return nil, err
+	}
+	iter := c.NewIterator(prefix.Bytes())
+	defer iter.Release()
+	records := make([]types.CrossChainRecord, 0)
+	for iter.Next() {
+		var record types.CrossChainRecord
+		if err := record.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// GetCrossChainWithdrawal returns the main chain withdrawal that paid out a
+// side chain transaction.
+func (c ChainStoreExtend) GetCrossChainWithdrawal(sideChainTxid string) (*types.CrossChainRecord, error) {
+	key, err := crossChainWithdrawalKey(sideChainTxid)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	record := new(types.CrossChainRecord)
+	if err := record.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// key: DataCrossChainDepositPrefix + side chain address + height + txid + index
+// value: serialized deposit record
+func crossChainDepositKey(address string, height uint32, txid string, index uint16) ([]byte, error) {
+	key := new(bytes.Buffer)
+	key.WriteByte(byte(DataCrossChainDepositPrefix))
+	if err := common2.WriteVarString(key, address); err != nil {
+		return nil, err
+	}
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], height)
+	key.Write(buf[:])
+	id, err := hex.DecodeString(txid)
+	if err != nil || len(id) != txidLength {
+		return nil, errors.New("invalid txid " + txid)
+	}
+	key.Write(id)
+	binary.BigEndian.PutUint16(buf[:2], index)
+	key.Write(buf[:2])
+	return key.Bytes(), nil
+}
+
+// key: DataCrossChainWithdrawalPrefix + side chain txid
+// value: serialized withdrawal record
+func crossChainWithdrawalKey(sideChainTxid string) ([]byte, error) {
+	id, err := hex.DecodeString(sideChainTxid)
+	if err != nil || len(id) != txidLength {
+		return nil, errors.New("invalid side chain txid " + sideChainTxid)
+	}
+	return append([]byte{byte(DataCrossChainWithdrawalPrefix)}, id...), nil
+}
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/common"
+	common2 "github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+func Test_CrossChainHistory(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, _ := testAddress(2)
+	genesisAddr := common2.Uint168{0x4B, 1}
+
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	deposit := testTransfer([]*types2.Input{testInput(coinbase, 0)},
+		testOutput(genesisAddr, 300), testOutput(genesisAddr, 200), testOutput(alice, 490))
+	deposit.TxType = types2.TransferCrossChainAsset
+	deposit.Payload = &payload.PayloadTransferCrossChainAsset{
+		CrossChainAddresses: []string{"EDID1", "EDID2"},
+		OutputIndexes:       []uint64{0, 1},
+		CrossChainAmounts:   []common2.Fixed64{299, 199},
+	}
+	sideChainTx := common2.Uint256{1, 2, 3}
+	withdrawal := testTransfer([]*types2.Input{testInput(deposit, 0)}, testOutput(bob, 290))
+	withdrawal.TxType = types2.WithdrawFromSideChain
+	withdrawal.Payload = &payload.PayloadWithdrawFromSideChain{
+		SideChainTransactionHashes: []common2.Uint256{sideChainTx},
+	}
+	var blocks []*types2.Block
+	for h, tx := range []*types2.Transaction{coinbase, deposit, withdrawal} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	q := NewTxHistoryQuery(aliceAddr)
+	q.FromHeight, q.ToHeight = 1, 1
+	page, err := c.GetTxHistoryPage(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.History) != 1 {
+		t.Fatalf("expect one deposit row, got %+v", page.History)
+	}
+	txh := page.History[0]
+	if txh.Value != 510 || txh.Fee != 12 {
+		t.Errorf("expect a spend of 510 with fee 12, got %d with fee %d", txh.Value, txh.Fee)
+	}
+	if len(txh.CrossChainAddresses) != 2 || txh.CrossChainAddresses[1] != "EDID2" ||
+		len(txh.CrossChainAmounts) != 2 || txh.CrossChainAmounts[1] != 199 {
+		t.Errorf("unexpected cross chain metadata %v %v", txh.CrossChainAddresses, txh.CrossChainAmounts)
+	}
+
+	deposits, err := c.GetCrossChainDeposits("EDID2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	depositTxid, _ := common.ReverseHexString(deposit.Hash().String())
+	if len(deposits) != 1 || deposits[0].Amount != 199 || deposits[0].Txid != depositTxid {
+		t.Errorf("unexpected deposits %+v", deposits)
+	}
+
+	sideChainTxid, _ := common.ReverseHexString(sideChainTx.String())
+	record, err := c.GetCrossChainWithdrawal(sideChainTxid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Height != 2 || record.TxType != "WithdrawFromSideChain" {
+		t.Errorf("unexpected withdrawal %+v", record)
+	}
+
+	if err := c.rollbackTxHistory(blocks[1]); err != nil {
+		t.Fatal(err)
+	}
+	if deposits, _ := c.GetCrossChainDeposits("EDID2"); len(deposits) != 0 {
+		t.Errorf("expect deposits to be rolled back, got %+v", deposits)
+	}
+	if _, err := c.GetCrossChainWithdrawal(sideChainTxid); err == nil {
+		t.Error("expect the withdrawal to be rolled back")
+	}
+}
@@ -3,5 +3,25 @@ package blockchain
 import . "github.com/elastos/Elastos.ELA/blockchain"
 
 const (
-	DataTxHistoryPrefix DataEntryPrefix = 0x60
+	DataTxHistoryPrefix     DataEntryPrefix = 0x60
+	DataIndexedHeightPrefix DataEntryPrefix = 0x61
+	DataHeightIndexPrefix   DataEntryPrefix = 0x62
+	DataSchemaVersionPrefix DataEntryPrefix = 0x63
+
+	DataCrossChainDepositPrefix    DataEntryPrefix = 0x64
+	DataCrossChainWithdrawalPrefix DataEntryPrefix = 0x65
+	DataBalancePrefix              DataEntryPrefix = 0x66
+	DataAddressSummaryPrefix       DataEntryPrefix = 0x67
+	DataRichListPrefix             DataEntryPrefix = 0x68
+	DataRichListHoldersPrefix      DataEntryPrefix = 0x69
+	DataRichListBucketPrefix       DataEntryPrefix = 0x71
+	DataSpentOutputPrefix          DataEntryPrefix = 0x6D
+
+	DataWebhookPrefix           DataEntryPrefix = 0x6A
+	DataWebhookOutboxPrefix     DataEntryPrefix = 0x6B
+	DataWebhookDeadLetterPrefix DataEntryPrefix = 0x6C
+	DataWebhookStatePrefix      DataEntryPrefix = 0x70
+
+	DataWorkLogPrefix    DataEntryPrefix = 0x6E
+	DataQuarantinePrefix DataEntryPrefix = 0x6F
 )
@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/contract"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/outputpayload"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// dposInfo is the producer and vote detail shared by the history rows of a
+// transaction.
+type dposInfo struct {
+	ownerKey string
+	deposit  uint64
+	votes    map[string][]string
+}
+
+// newDposInfo collects the producer owner key, the deposit paid and the
+// candidates voted by every address of a transaction. The deposit returned
+// by a ReturnDepositCoin is added from its inputs with addInput.
+func newDposInfo(tx *Transaction) *dposInfo {
+	info := &dposInfo{votes: make(map[string][]string)}
+	switch pl := tx.Payload.(type) {
+	case *payload.PayloadRegisterProducer:
+		info.ownerKey = common.BytesToHexString(pl.OwnerPublicKey)
+	case *payload.PayloadUpdateProducer:
+		info.ownerKey = common.BytesToHexString(pl.OwnerPublicKey)
+	case *payload.PayloadCancelProducer:
+		info.ownerKey = common.BytesToHexString(pl.OwnerPublicKey)
+	}
+	for _, output := range tx.Outputs {
+		if tx.TxType == RegisterProducer && isDepositProgramHash(output.ProgramHash) {
+			info.deposit += uint64(output.Value)
+		}
+		vote, ok := output.OutputPayload.(*outputpayload.VoteOutput)
+		if !ok || output.OutputType != VoteOutput {
+			continue
+		}
+		address, _ := output.ProgramHash.ToAddress()
+		for _, content := range vote.Contents {
+			for _, candidate := range content.Candidates {
+				info.votes[address] = append(info.votes[address], common.BytesToHexString(candidate))
+			}
+		}
+	}
+	return info
+}
+
+// addInput adds a spent output to the deposit returned by the transaction.
+func (info *dposInfo) addInput(tx *Transaction, output *Output) {
+	if tx.TxType == ReturnDepositCoin && isDepositProgramHash(output.ProgramHash) {
+		info.deposit += uint64(output.Value)
+	}
+}
+
+// apply copies the detail into the history row of an address.
+func (info *dposInfo) apply(txh *types.TransactionHistory) {
+	txh.ProducerOwnerKey = info.ownerKey
+	txh.DepositAmount = info.deposit
+	txh.Votes = info.votes[txh.Address]
+}
+
+// txTypeName names the transaction type of history rows. Transfers that
+// cast votes are named VOTE.
+func txTypeName(tx *Transaction) string {
+	if tx.TxType == TransferAsset {
+		for _, output := range tx.Outputs {
+			if output.OutputType == VoteOutput {
+				return VOTE
+			}
+		}
+	}
+	return txTypeEnum[tx.TxType]
+}
+
+func isDepositProgramHash(programHash common.Uint168) bool {
+	return programHash[0] == byte(contract.PrefixDeposit)
+}
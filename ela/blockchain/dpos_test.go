@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"testing"
+
+	common2 "github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/outputpayload"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+func Test_DposHistory(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	depositHash := common2.Uint168{0x1F, 1}
+	depositAddr, _ := depositHash.ToAddress()
+	ownerKey := []byte{0x02, 0xaa}
+
+	coinbase := testCoinbase(0, testOutput(alice, 10000))
+	register := testTransfer([]*types2.Input{testInput(coinbase, 0)},
+		testOutput(depositHash, 5000), testOutput(alice, 4990))
+	register.TxType = types2.RegisterProducer
+	register.Payload = &payload.PayloadRegisterProducer{OwnerPublicKey: ownerKey}
+	voteOutput := testOutput(alice, 4980)
+	voteOutput.OutputType = types2.VoteOutput
+	voteOutput.OutputPayload = &outputpayload.VoteOutput{
+		Contents: []outputpayload.VoteContent{{Candidates: [][]byte{ownerKey}}},
+	}
+	vote := testTransfer([]*types2.Input{testInput(register, 1)}, voteOutput)
+	cancel := testTransfer(nil)
+	cancel.TxType = types2.CancelProducer
+	cancel.Payload = &payload.PayloadCancelProducer{OwnerPublicKey: ownerKey}
+	returnDeposit := testTransfer([]*types2.Input{testInput(register, 0)}, testOutput(alice, 4999))
+	returnDeposit.TxType = types2.ReturnDepositCoin
+	returnDeposit.Payload = &payload.PayloadReturnDepositCoin{}
+	for h, tx := range []*types2.Transaction{coinbase, register, vote, cancel, returnDeposit} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		addr    string
+		height  uint32
+		txType  string
+		votes   int
+		owner   string
+		deposit uint64
+	}{
+		{aliceAddr, 1, "RegisterProducer", 0, "02aa", 5000},
+		{depositAddr, 1, "RegisterProducer", 0, "02aa", 5000},
+		{aliceAddr, 2, VOTE, 1, "", 0},
+		{aliceAddr, 4, "ReturnDepositCoin", 0, "", 5000},
+		{depositAddr, 4, "ReturnDepositCoin", 0, "", 5000},
+	}
+	for _, test := range tests {
+		q := NewTxHistoryQuery(test.addr)
+		q.FromHeight, q.ToHeight = test.height, test.height
+		page, err := c.GetTxHistoryPage(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.History) != 1 {
+			t.Fatalf("%s at height %d: expect one row, got %+v", test.addr, test.height, page.History)
+		}
+		txh := page.History[0]
+		if txh.TxType != test.txType || len(txh.Votes) != test.votes ||
+			txh.ProducerOwnerKey != test.owner || txh.DepositAmount != test.deposit {
+			t.Errorf("%s at height %d: unexpected row %+v", test.addr, test.height, txh)
+		}
+	}
+
+	q := NewTxHistoryQuery(aliceAddr)
+	q.TxType = VOTE
+	page, err := c.GetTxHistoryPage(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total == nil || *page.Total != 1 || page.History[0].Votes[0] != "02aa" {
+		t.Errorf("expect the vote to be found by type, got %+v", page.History)
+	}
+}
@@ -0,0 +1,325 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	. "github.com/elastos/Elastos.ELA/blockchain"
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// txHistorySuffixLength is the length of the part of a history key that
+// follows the address: height + txid + role.
+const txHistorySuffixLength = 4 + txidLength + 1
+
+// TxHistoryQuery selects a page of the transaction history of an address.
+// Rows are ordered by height, then txid. A page starts right after Cursor
+// when it is set, otherwise PageNum pages of PageSize rows are skipped.
+// Skipped rows are still read one by one, deep pages are cheaper to reach
+// with the cursor of the previous page.
+// Type, TxType, the time window and MinValue filter the rows before they
+// are paged and counted, an empty Type or TxType matches every row.
+type TxHistoryQuery struct {
+	Address    string
+	FromHeight uint32
+	ToHeight   uint32
+	PageSize   uint32
+	PageNum    uint32
+	Cursor     string
+	Descending bool
+	Type       string
+	TxType     string
+	FromTime   uint64
+	ToTime     uint64
+	MinValue   uint64
+}
+
+// NewTxHistoryQuery returns a query for every row of an address.
+func NewTxHistoryQuery(address string) TxHistoryQuery {
+	return TxHistoryQuery{
+		Address:  address,
+		ToHeight: math.MaxUint32,
+		PageNum:  1,
+		ToTime:   math.MaxUint64,
+	}
+}
+
+// validate checks the filters of the query.
+func (q *TxHistoryQuery) validate() error {
+	if q.Type != "" && q.Type != INCOME && q.Type != SPEND {
+		return errors.New("invalid type")
+	}
+	if q.TxType != "" && !isTxTypeName(q.TxType) {
+		return errors.New("invalid txtype")
+	}
+	if q.FromHeight > q.ToHeight || q.FromTime > q.ToTime {
+		return errors.New("invalid range")
+	}
+	return nil
+}
+
+// filtered reports whether rows have to be decoded to be matched.
+func (q *TxHistoryQuery) filtered() bool {
+	return q.Type != "" || q.TxType != "" || q.FromTime > 0 ||
+		q.ToTime < math.MaxUint64 || q.MinValue > 0
+}
+
+// match reports whether a row passes the filters of the query.
+func (q *TxHistoryQuery) match(txh *types.TransactionHistory) bool {
+	if q.Type != "" && txh.Type != q.Type {
+		return false
+	}
+	if q.TxType != "" && txh.TxType != q.TxType {
+		return false
+	}
+	return txh.CreateTime >= q.FromTime && txh.CreateTime <= q.ToTime &&
+		txh.Value >= q.MinValue
+}
+
+func isTxTypeName(name string) bool {
+	if name == VOTE {
+		return true
+	}
+	for _, n := range txTypeEnum {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TxHistoryPage is a page of transaction history. Total counts every row
+// matched by the query, NextCursor is empty on the last page. Total is left
+// out of the pages reached by a cursor when the query filters on the content
+// of the rows, counting them means reading the whole range again.
+type TxHistoryPage struct {
+	History    types.TransactionHistorySorter
+	Total      *uint64 `json:",omitempty"`
+	NextCursor string
+}
+
+// GetTxHistoryPage serves a page of history straight from the store, walking
+// the rows of the address in key order.
+func (c ChainStoreExtend) GetTxHistoryPage(query TxHistoryQuery) (*TxHistoryPage, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	prefix, err := txHistoryPrefix(query.Address)
+	if err != nil {
+		return nil, err
+	}
+	var cursor []byte
+	if query.Cursor != "" {
+		cursor, err = hex.DecodeString(query.Cursor)
+		if err != nil || len(cursor) != txHistorySuffixLength {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+
+	iter := c.NewIterator(prefix)
+	defer iter.Release()
+	var ok bool
+	if query.Descending {
+		ok = seekDescending(iter, prefix, cursor, query.ToHeight)
+	} else {
+		ok = seekAscending(iter, prefix, cursor, query.FromHeight)
+	}
+
+	var skip uint64
+	if cursor == nil && query.PageNum > 1 {
+		skip = uint64(query.PageNum-1) * uint64(query.PageSize)
+	}
+	page := &TxHistoryPage{History: types.TransactionHistorySorter{}}
+	var last []byte
+	for ; ok; ok = advance(iter, query.Descending) {
+		suffix := iter.Key()[len(prefix):]
+		height := binary.BigEndian.Uint32(suffix)
+		if height < query.FromHeight || height > query.ToHeight {
+			break
+		}
+		var txh *types.TransactionHistory
+		if query.filtered() {
+			if txh, err = decodeTxHistory(iter.Value()); err != nil {
+				return nil, err
+			}
+			if !query.match(txh) {
+				continue
+			}
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if query.PageSize > 0 && uint32(len(page.History)) == query.PageSize {
+			page.NextCursor = hex.EncodeToString(last)
+			break
+		}
+		if txh == nil {
+			if txh, err = decodeTxHistory(iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		page.History = append(page.History, *txh)
+		last = append(last[:0], suffix...)
+	}
+
+	var total uint64
+	switch {
+	case !query.filtered():
+		total, err = c.countTxHistoryRange(query.Address, query.FromHeight, query.ToHeight)
+	case cursor == nil:
+		total, err = c.countTxHistory(prefix, &query)
+	default:
+		return page, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	page.Total = &total
+	return page, nil
+}
+
+// WalkTxHistory calls fn with every row of an address matched by the query,
+// reading them one at a time from the store. The paging fields of the query
+// are ignored. Walking stops at the first error returned by fn.
+func (c ChainStoreExtend) WalkTxHistory(query TxHistoryQuery, fn func(txh *types.TransactionHistory) error) error {
+	if err := query.validate(); err != nil {
+		return err
+	}
+	prefix, err := txHistoryPrefix(query.Address)
+	if err != nil {
+		return err
+	}
+	iter := c.NewIterator(prefix)
+	defer iter.Release()
+	var ok bool
+	if query.Descending {
+		ok = seekDescending(iter, prefix, nil, query.ToHeight)
+	} else {
+		ok = seekAscending(iter, prefix, nil, query.FromHeight)
+	}
+	for ; ok; ok = advance(iter, query.Descending) {
+		height := binary.BigEndian.Uint32(iter.Key()[len(prefix):])
+		if height < query.FromHeight || height > query.ToHeight {
+			break
+		}
+		txh, err := decodeTxHistory(iter.Value())
+		if err != nil {
+			return err
+		}
+		if !query.match(txh) {
+			continue
+		}
+		if err := fn(txh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countTxHistory counts the rows of an address matched by the filters of
+// the query, decoding every row of the height range.
+func (c ChainStoreExtend) countTxHistory(prefix []byte, query *TxHistoryQuery) (uint64, error) {
+	iter := c.NewIterator(prefix)
+	defer iter.Release()
+	var count uint64
+	for ok := seekAscending(iter, prefix, nil, query.FromHeight); ok; ok = iter.Next() {
+		if binary.BigEndian.Uint32(iter.Key()[len(prefix):]) > query.ToHeight {
+			break
+		}
+		txh, err := decodeTxHistory(iter.Value())
+		if err != nil {
+			return 0, err
+		}
+		if query.match(txh) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// countTxHistoryRange counts the rows of an address between two heights
+// from the tx counts of its summaries, a summary counting one tx per row.
+func (c ChainStoreExtend) countTxHistoryRange(address string, from, to uint32) (uint64, error) {
+	prefix, err := addressSnapshotPrefix(DataAddressSummaryPrefix, address)
+	if err != nil {
+		return 0, err
+	}
+	var upper, lower AddressSummary
+	if _, err := c.getAddressSnapshot(prefix, to, &upper); err != nil {
+		return 0, err
+	}
+	if from > 0 {
+		if _, err := c.getAddressSnapshot(prefix, from-1, &lower); err != nil {
+			return 0, err
+		}
+	}
+	return upper.TxCount - lower.TxCount, nil
+}
+
+func decodeTxHistory(value []byte) (*types.TransactionHistory, error) {
+	txh := new(types.TransactionHistory)
+	if err := txh.Deserialize(bytes.NewReader(value)); err != nil {
+		return nil, err
+	}
+	return txh, nil
+}
+
+// txHistoryPrefix is the key prefix shared by every row of an address.
+func txHistoryPrefix(address string) ([]byte, error) {
+	key := new(bytes.Buffer)
+	key.WriteByte(byte(DataTxHistoryPrefix))
+	if err := common.WriteVarString(key, address); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+// seekAscending moves the iterator to the first row after the cursor, or to
+// the first row at or above the height when there is no cursor.
+func seekAscending(iter IIterator, prefix, cursor []byte, from uint32) bool {
+	if cursor != nil {
+		target := append(append([]byte{}, prefix...), cursor...)
+		if !iter.Seek(target) {
+			return false
+		}
+		if bytes.Equal(iter.Key(), target) {
+			return iter.Next()
+		}
+		return true
+	}
+	return iter.Seek(heightKey(prefix, from))
+}
+
+// seekDescending moves the iterator to the last row before the cursor, or to
+// the last row at or below the height when there is no cursor.
+func seekDescending(iter IIterator, prefix, cursor []byte, to uint32) bool {
+	var target []byte
+	if cursor != nil {
+		target = append(append([]byte{}, prefix...), cursor...)
+	} else if to < math.MaxUint32 {
+		target = heightKey(prefix, to+1)
+	}
+	if target == nil || !iter.Seek(target) {
+		return iter.Last()
+	}
+	return iter.Prev()
+}
+
+func advance(iter IIterator, descending bool) bool {
+	if descending {
+		return iter.Prev()
+	}
+	return iter.Next()
+}
+
+func heightKey(prefix []byte, height uint32) []byte {
+	key := make([]byte, len(prefix)+4)
+	copy(key, prefix)
+	binary.BigEndian.PutUint32(key[len(prefix):], height)
+	return key
+}
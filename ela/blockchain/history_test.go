@@ -0,0 +1,246 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// persistTestChain indexes one coinbase block per height, each paying the
+// given address, and returns the store.
+func persistTestChain(t *testing.T, blocks int) (ChainStoreExtend, string) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	miner, addr := testAddress(1)
+	for h := 0; h < blocks; h++ {
+		b := testBlock(uint32(h), testCoinbase(uint32(h), testOutput(miner, 100)))
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c, addr
+}
+
+func heights(page *TxHistoryPage) []uint64 {
+	var hs []uint64
+	for _, txh := range page.History {
+		hs = append(hs, txh.Height)
+	}
+	return hs
+}
+
+func equalHeights(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_GetTxHistoryPage(t *testing.T) {
+	c, addr := persistTestChain(t, 10)
+
+	tests := []struct {
+		name   string
+		modify func(q *TxHistoryQuery)
+		expect []uint64
+		total  uint64
+		more   bool
+	}{
+		{"all", func(q *TxHistoryQuery) {}, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 10, false},
+		{"first page", func(q *TxHistoryQuery) { q.PageSize = 4 }, []uint64{0, 1, 2, 3}, 10, true},
+		{"page number", func(q *TxHistoryQuery) { q.PageSize = 4; q.PageNum = 3 }, []uint64{8, 9}, 10, false},
+		{"descending", func(q *TxHistoryQuery) { q.PageSize = 3; q.Descending = true }, []uint64{9, 8, 7}, 10, true},
+		{"height range", func(q *TxHistoryQuery) { q.FromHeight = 3; q.ToHeight = 5 }, []uint64{3, 4, 5}, 3, false},
+		{"descending range", func(q *TxHistoryQuery) { q.FromHeight = 3; q.ToHeight = 5; q.Descending = true }, []uint64{5, 4, 3}, 3, false},
+		{"time window", func(q *TxHistoryQuery) { q.FromTime = 1500000240; q.ToTime = 1500000480 }, []uint64{2, 3, 4}, 3, false},
+		{"time window page", func(q *TxHistoryQuery) { q.FromTime = 1500000240; q.PageSize = 2; q.PageNum = 2 }, []uint64{4, 5}, 8, true},
+		{"coinbase", func(q *TxHistoryQuery) { q.TxType = "CoinBase"; q.Type = INCOME }, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 10, false},
+		{"no spend", func(q *TxHistoryQuery) { q.Type = SPEND }, nil, 0, false},
+		{"min value", func(q *TxHistoryQuery) { q.MinValue = 101 }, nil, 0, false},
+	}
+	for _, test := range tests {
+		q := NewTxHistoryQuery(addr)
+		test.modify(&q)
+		page, err := c.GetTxHistoryPage(q)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !equalHeights(heights(page), test.expect) {
+			t.Errorf("%s: expect heights %v, got %v", test.name, test.expect, heights(page))
+		}
+		if page.Total == nil || *page.Total != test.total {
+			t.Errorf("%s: expect total %d, got %v", test.name, test.total, page.Total)
+		}
+		if (page.NextCursor != "") != test.more {
+			t.Errorf("%s: unexpected next cursor %q", test.name, page.NextCursor)
+		}
+	}
+}
+
+func Test_GetTxHistoryPageFilter(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, _ := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	small := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 10), testOutput(alice, 980))
+	large := testTransfer([]*types2.Input{testInput(small, 1)}, testOutput(bob, 900), testOutput(alice, 70))
+	for h, tx := range []*types2.Transaction{coinbase, small, large} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(q *TxHistoryQuery)
+		expect []uint64
+	}{
+		{"income", func(q *TxHistoryQuery) { q.Type = INCOME }, []uint64{0}},
+		{"spend", func(q *TxHistoryQuery) { q.Type = SPEND }, []uint64{1, 2}},
+		{"transfer", func(q *TxHistoryQuery) { q.TxType = "TransferAsset" }, []uint64{1, 2}},
+		{"large spend", func(q *TxHistoryQuery) { q.Type = SPEND; q.MinValue = 100 }, []uint64{2}},
+		{"descending spend", func(q *TxHistoryQuery) { q.Type = SPEND; q.Descending = true }, []uint64{2, 1}},
+	}
+	for _, test := range tests {
+		q := NewTxHistoryQuery(aliceAddr)
+		test.modify(&q)
+		page, err := c.GetTxHistoryPage(q)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !equalHeights(heights(page), test.expect) {
+			t.Errorf("%s: expect heights %v, got %v", test.name, test.expect, heights(page))
+		}
+		if page.Total == nil || *page.Total != uint64(len(test.expect)) {
+			t.Errorf("%s: expect total %d, got %v", test.name, len(test.expect), page.Total)
+		}
+	}
+
+	for _, modify := range []func(q *TxHistoryQuery){
+		func(q *TxHistoryQuery) { q.Type = "both" },
+		func(q *TxHistoryQuery) { q.TxType = "Unknown" },
+		func(q *TxHistoryQuery) { q.FromTime = 2; q.ToTime = 1 },
+	} {
+		q := NewTxHistoryQuery(aliceAddr)
+		modify(&q)
+		if _, err := c.GetTxHistoryPage(q); err == nil {
+			t.Errorf("expect query %+v to be rejected", q)
+		}
+	}
+}
+
+func Test_GetTxHistoryPageCursor(t *testing.T) {
+	c, addr := persistTestChain(t, 7)
+	for _, descending := range []bool{false, true} {
+		q := NewTxHistoryQuery(addr)
+		q.PageSize = 3
+		q.Descending = descending
+		var all []uint64
+		for {
+			page, err := c.GetTxHistoryPage(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, heights(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		expect := []uint64{0, 1, 2, 3, 4, 5, 6}
+		if descending {
+			expect = []uint64{6, 5, 4, 3, 2, 1, 0}
+		}
+		if !equalHeights(all, expect) {
+			t.Errorf("descending %v: expect %v, got %v", descending, expect, all)
+		}
+	}
+
+	q := NewTxHistoryQuery(addr)
+	q.Cursor = "00"
+	if _, err := c.GetTxHistoryPage(q); err == nil {
+		t.Error("expect an invalid cursor to be rejected")
+	}
+}
+
+func Test_GetTxHistoryPageTotal(t *testing.T) {
+	c, addr := persistTestChain(t, 7)
+	q := NewTxHistoryQuery(addr)
+	q.PageSize = 2
+	q.FromHeight = 2
+	first, err := c.GetTxHistoryPage(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Cursor = first.NextCursor
+	next, err := c.GetTxHistoryPage(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Total == nil || *next.Total != 5 {
+		t.Errorf("expect the total of the range on every page, got %v", next.Total)
+	}
+
+	q.FromTime = 1
+	if next, err = c.GetTxHistoryPage(q); err != nil {
+		t.Fatal(err)
+	}
+	if next.Total != nil || len(next.History) != 2 {
+		t.Errorf("expect no filtered total after the first page, got %v %v", next.Total, heights(next))
+	}
+
+	// an address without history
+	_, other := testAddress(2)
+	page, err := c.GetTxHistoryPage(NewTxHistoryQuery(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total == nil || *page.Total != 0 {
+		t.Errorf("expect a zero total, got %v", page.Total)
+	}
+}
+
+func Test_WalkTxHistory(t *testing.T) {
+	c, addr := persistTestChain(t, 6)
+	query := NewTxHistoryQuery(addr)
+	query.FromHeight = 1
+	query.ToHeight = 4
+	query.Descending = true
+	query.PageSize = 1
+
+	var hs []uint64
+	err := c.WalkTxHistory(query, func(txh *types.TransactionHistory) error {
+		hs = append(hs, txh.Height)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []uint64{4, 3, 2, 1}; !equalHeights(hs, expect) {
+		t.Errorf("expect heights %v, got %v", expect, hs)
+	}
+
+	stop := errors.New("stop")
+	hs = nil
+	err = c.WalkTxHistory(NewTxHistoryQuery(addr), func(txh *types.TransactionHistory) error {
+		hs = append(hs, txh.Height)
+		if len(hs) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(hs) != 2 {
+		t.Errorf("expect the walk to stop after 2 rows, got %v %v", hs, err)
+	}
+}
@@ -3,6 +3,7 @@ package blockchain
 import (
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
 	. "github.com/elastos/Elastos.ELA/blockchain"
+	"github.com/elastos/Elastos.ELA/common"
 	. "github.com/elastos/Elastos.ELA/core/types"
 )
 
@@ -14,4 +15,28 @@ type IChainStoreExtend interface {
 	CloseEx()
 	AddTask(task interface{})
 	GetTxHistory(addr string) types.TransactionHistorySorter
+	GetTxHistoryPage(query TxHistoryQuery) (*TxHistoryPage, error)
+	WalkTxHistory(query TxHistoryQuery, fn func(txh *types.TransactionHistory) error) error
+	GetCrossChainDeposits(address string) ([]types.CrossChainRecord, error)
+	GetCrossChainWithdrawal(sideChainTxid string) (*types.CrossChainRecord, error)
+	GetBalanceAt(address string, height uint32) (*BalanceSnapshot, bool, error)
+	GetBalanceAtTime(address string, time uint64) (*BalanceSnapshot, bool, error)
+	GetBalanceSeries(address string, from, to, limit uint32) ([]BalanceSnapshot, error)
+	GetAddressSummary(address string) (*AddressSummary, bool, error)
+	GetRichList(offset, limit uint64) ([]RichListEntry, uint64, error)
+	GetRichListRank(address string) (*RichListEntry, bool, error)
+	GetSpentBy(txid common.Uint256, index uint16) (*SpentOutput, bool, error)
+	SyncPendingTransactions(pool map[common.Uint256]*Transaction)
+	WatchTxPool(pool TxPool)
+	OnTxPoolChanged()
+	GetPendingTxHistory(address string) types.TransactionHistorySorter
+	GetWalletTxHistoryPage(query WalletTxHistoryQuery) (*WalletTxHistoryPage, error)
+	RegisterHistoryListener(listener HistoryListener)
+	StartVerify(repair bool) bool
+	GetVerifyReport() (*VerifyReport, bool)
+	GetIndexLag() IndexLag
+	GetQuarantine() ([]QuarantinedBlock, error)
+	RetryQuarantined(height uint32) (bool, error)
+	QuarantinedHeights(to uint32) []uint32
+	GetOutputCacheStats() OutputCacheStats
 }
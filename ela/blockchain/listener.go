@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+)
+
+// HistoryListener is told about new history rows: the rows of a block once
+// they are stored, and the pending rows of a transaction once it is seen in
+// the transaction pool.
+type HistoryListener interface {
+	OnTxHistory(txhs []types.TransactionHistory)
+}
+
+type historyListeners struct {
+	sync.RWMutex
+	list []HistoryListener
+}
+
+// RegisterHistoryListener adds a listener told about every new history row.
+func (c ChainStoreExtend) RegisterHistoryListener(listener HistoryListener) {
+	c.listeners.Lock()
+	defer c.listeners.Unlock()
+	c.listeners.list = append(c.listeners.list, listener)
+}
+
+// HistoryBatch is the batch the entries derived from a block are written to.
+type HistoryBatch interface {
+	BatchPut(key []byte, value []byte)
+}
+
+// BatchHistoryListener is a HistoryListener also writing entries of its own
+// for the rows of a block, in the batch storing the rows. Both are committed
+// together, so a crash cannot keep one without the other.
+type BatchHistoryListener interface {
+	HistoryListener
+	BatchTxHistory(batch HistoryBatch, txhs []types.TransactionHistory)
+}
+
+// RollbackHistoryListener is told that the rows of the blocks from a height
+// up are removed, in the batch removing them.
+type RollbackHistoryListener interface {
+	BatchRollback(batch HistoryBatch, height uint32)
+}
+
+// batchTxHistory lets the listeners write their entries for the rows of a
+// block to the open batch, before it is committed.
+func (c ChainStoreExtend) batchTxHistory(txhs []types.TransactionHistory) {
+	if len(txhs) == 0 {
+		return
+	}
+	c.listeners.RLock()
+	defer c.listeners.RUnlock()
+	for _, listener := range c.listeners.list {
+		if l, ok := listener.(BatchHistoryListener); ok {
+			l.BatchTxHistory(c, txhs)
+		}
+	}
+}
+
+func (c ChainStoreExtend) notifyTxHistory(txhs []types.TransactionHistory) {
+	if len(txhs) == 0 {
+		return
+	}
+	c.listeners.RLock()
+	defer c.listeners.RUnlock()
+	for _, listener := range c.listeners.list {
+		listener.OnTxHistory(txhs)
+	}
+}
+
+// batchRollback tells the listeners about a rollback to a height before the
+// batch removing the rows is committed.
+func (c ChainStoreExtend) batchRollback(height uint32) {
+	c.listeners.RLock()
+	defer c.listeners.RUnlock()
+	for _, listener := range c.listeners.list {
+		if l, ok := listener.(RollbackHistoryListener); ok {
+			l.BatchRollback(c, height)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+type testListener struct {
+	rows [][]types.TransactionHistory
+}
+
+func (l *testListener) OnTxHistory(txhs []types.TransactionHistory) {
+	l.rows = append(l.rows, txhs)
+}
+
+func Test_HistoryListener(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	listener := new(testListener)
+	c.RegisterHistoryListener(listener)
+	alice, _ := testAddress(1)
+	bob, bobAddr := testAddress(2)
+
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	genesis := testBlock(0, coinbase)
+	chain.connect(genesis)
+	if err := c.persistTxHistory(genesis); err != nil {
+		t.Fatal(err)
+	}
+	if len(listener.rows) != 1 || len(listener.rows[0]) != 1 || listener.rows[0][0].Status != "" {
+		t.Fatalf("expect the coinbase row to be notified, got %+v", listener.rows)
+	}
+
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 990))
+	c.SyncPendingTransactions(pendingPool(pay))
+	c.SyncPendingTransactions(pendingPool(pay))
+	if len(listener.rows) != 2 || len(listener.rows[1]) != 2 {
+		t.Fatalf("expect the pending rows to be notified once, got %+v", listener.rows)
+	}
+	for _, txh := range listener.rows[1] {
+		if txh.Status != types.TxStatusPending {
+			t.Errorf("expect a pending row, got %+v", txh)
+		}
+	}
+
+	block := testBlock(1, testCoinbase(1, testOutput(alice, 1)), pay)
+	chain.connect(block)
+	if err := c.persistTxHistory(block); err != nil {
+		t.Fatal(err)
+	}
+	var confirmed bool
+	for _, txh := range listener.rows[len(listener.rows)-1] {
+		if txh.Address == bobAddr && txh.Height == 1 && txh.Status == "" {
+			confirmed = true
+		}
+	}
+	if !confirmed {
+		t.Errorf("expect the confirmed row of bob to be notified, got %+v", listener.rows)
+	}
+}
+
+// testBatchListener writes a marker per block in the batch of its rows.
+type testBatchListener struct {
+	testListener
+}
+
+func (l *testBatchListener) BatchTxHistory(batch HistoryBatch, txhs []types.TransactionHistory) {
+	batch.BatchPut([]byte{byte(DataWebhookOutboxPrefix), byte(txhs[0].Height)}, []byte{0x01})
+}
+
+func Test_BatchHistoryListener(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	listener := new(testBatchListener)
+	c.RegisterHistoryListener(listener)
+	alice, _ := testAddress(1)
+
+	genesis := testBlock(0, testCoinbase(0, testOutput(alice, 1000)))
+	chain.connect(genesis)
+	if err := c.persistTxHistory(genesis); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get([]byte{byte(DataWebhookOutboxPrefix), 0}); err != nil {
+		t.Errorf("expect the entry of the listener committed with the rows, got %v", err)
+	}
+	if len(listener.rows) != 1 {
+		t.Errorf("expect the rows notified after the commit, got %+v", listener.rows)
+	}
+}
+
+// testRollbackListener records the heights rolled back to.
+type testRollbackListener struct {
+	testListener
+	heights []uint32
+}
+
+func (l *testRollbackListener) BatchRollback(batch HistoryBatch, height uint32) {
+	l.heights = append(l.heights, height)
+}
+
+func Test_RollbackHistoryListener(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	listener := new(testRollbackListener)
+	c.RegisterHistoryListener(listener)
+	testChain(chain, 3)
+	if closed, err := c.catchUp(chain.GetHeight()); closed != nil || err != nil {
+		t.Fatal(closed, err)
+	}
+	if err := c.rollbackTxHistory(chain.disconnect()); err != nil {
+		t.Fatal(err)
+	}
+	if len(listener.heights) != 1 || listener.heights[0] != 2 {
+		t.Errorf("expect the rollback to height 2 told, got %v", listener.heights)
+	}
+}
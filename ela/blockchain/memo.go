@@ -0,0 +1,44 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// maxMemoLength is the largest memo in bytes stored with a history row,
+// longer memos are cut at a character boundary.
+const maxMemoLength = 512
+
+// txMemo joins the memo and description attributes of a transaction. Data
+// that is not valid UTF-8 is stored hex encoded.
+func txMemo(tx *Transaction) string {
+	var parts []string
+	for _, attr := range tx.Attributes {
+		if attr.Usage != Memo && attr.Usage != Description {
+			continue
+		}
+		if len(attr.Data) == 0 {
+			continue
+		}
+		if utf8.Valid(attr.Data) {
+			parts = append(parts, string(attr.Data))
+		} else {
+			parts = append(parts, hex.EncodeToString(attr.Data))
+		}
+	}
+	return truncateMemo(strings.Join(parts, "\n"))
+}
+
+func truncateMemo(memo string) string {
+	if len(memo) <= maxMemoLength {
+		return memo
+	}
+	end := maxMemoLength
+	for end > 0 && !utf8.RuneStart(memo[end]) {
+		end--
+	}
+	return memo[:end]
+}
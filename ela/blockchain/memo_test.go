@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_TxMemo(t *testing.T) {
+	long := strings.Repeat("é", maxMemoLength)
+	tests := []struct {
+		name   string
+		attrs  []*types2.Attribute
+		expect string
+	}{
+		{"none", nil, ""},
+		{"nonce only", []*types2.Attribute{{Usage: types2.Nonce, Data: []byte("123")}}, ""},
+		{"memo", []*types2.Attribute{{Usage: types2.Memo, Data: []byte("invoice 42")}}, "invoice 42"},
+		{"memo and description", []*types2.Attribute{
+			{Usage: types2.Description, Data: []byte("rent")},
+			{Usage: types2.Memo, Data: []byte("may")},
+		}, "rent\nmay"},
+		{"invalid utf8", []*types2.Attribute{{Usage: types2.Memo, Data: []byte{0xff, 0x00}}}, "ff00"},
+		{"truncated", []*types2.Attribute{{Usage: types2.Memo, Data: []byte(long)}}, long[:maxMemoLength]},
+	}
+	for _, test := range tests {
+		memo := txMemo(&types2.Transaction{Attributes: test.attrs})
+		if memo != test.expect {
+			t.Errorf("%s: expect memo %q, got %q", test.name, test.expect, memo)
+		}
+		if len(memo) > maxMemoLength || !utf8.ValidString(memo) {
+			t.Errorf("%s: memo %q is not capped valid utf8", test.name, memo)
+		}
+	}
+}
+
+func Test_PersistTxHistoryMemo(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	transfer := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 10), testOutput(alice, 980))
+	transfer.Attributes = []*types2.Attribute{{Usage: types2.Memo, Data: []byte("order 7")}}
+	for h, tx := range []*types2.Transaction{coinbase, transfer} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, addr := range []string{aliceAddr, bobAddr} {
+		q := NewTxHistoryQuery(addr)
+		q.FromHeight = 1
+		page, err := c.GetTxHistoryPage(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.History) != 1 || page.History[0].Memo != "order 7" {
+			t.Errorf("%s: expect the transfer memo, got %+v", addr, page.History)
+		}
+	}
+}
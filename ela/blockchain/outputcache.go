@@ -0,0 +1,163 @@
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// outputCacheSize is the number of outputs kept for the inputs of the next
+// blocks to spend.
+const outputCacheSize = 100000
+
+// OutputCacheStats counts the lookups of spent outputs answered by the
+// output cache.
+type OutputCacheStats struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRate  float64 `json:"hitrate"`
+	Size     int     `json:"size"`
+	Capacity int     `json:"capacity"`
+}
+
+type cachedOutput struct {
+	outpoint OutPoint
+	output   *Output
+}
+
+// outputCache keeps the outputs of the recently indexed blocks, least
+// recently used first out, so the inputs spending them are resolved without
+// reading their transaction back from the chain store. An outpoint always
+// names the same output, so entries never go stale on a rollback.
+type outputCache struct {
+	sync.Mutex
+	capacity int
+	items    map[OutPoint]*list.Element
+	order    *list.List
+	hits     uint64
+	misses   uint64
+}
+
+func newOutputCache(capacity int) *outputCache {
+	return &outputCache{
+		capacity: capacity,
+		items:    make(map[OutPoint]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (oc *outputCache) get(outpoint OutPoint) (*Output, bool) {
+	oc.Lock()
+	defer oc.Unlock()
+	elem, ok := oc.items[outpoint]
+	if !ok {
+		oc.misses++
+		return nil, false
+	}
+	oc.hits++
+	oc.order.MoveToFront(elem)
+	return elem.Value.(*cachedOutput).output, true
+}
+
+func (oc *outputCache) add(outpoint OutPoint, output *Output) {
+	oc.Lock()
+	defer oc.Unlock()
+	if elem, ok := oc.items[outpoint]; ok {
+		oc.order.MoveToFront(elem)
+		return
+	}
+	oc.items[outpoint] = oc.order.PushFront(&cachedOutput{outpoint, output})
+	for oc.order.Len() > oc.capacity {
+		oldest := oc.order.Back()
+		oc.order.Remove(oldest)
+		delete(oc.items, oldest.Value.(*cachedOutput).outpoint)
+	}
+}
+
+func (oc *outputCache) remove(outpoint OutPoint) {
+	oc.Lock()
+	defer oc.Unlock()
+	if elem, ok := oc.items[outpoint]; ok {
+		oc.order.Remove(elem)
+		delete(oc.items, outpoint)
+	}
+}
+
+func (oc *outputCache) stats() OutputCacheStats {
+	oc.Lock()
+	defer oc.Unlock()
+	stats := OutputCacheStats{
+		Hits:     oc.hits,
+		Misses:   oc.misses,
+		Size:     oc.order.Len(),
+		Capacity: oc.capacity,
+	}
+	if total := oc.hits + oc.misses; total > 0 {
+		stats.HitRate = float64(oc.hits) / float64(total)
+	}
+	return stats
+}
+
+// GetOutputCacheStats returns the hit rate of the output cache since the
+// node started.
+func (c ChainStoreExtend) GetOutputCacheStats() OutputCacheStats {
+	return c.outputs.stats()
+}
+
+// cacheOutputs adds the outputs of an indexed block to the output cache and
+// drops the outputs its inputs spent, which no later block spends again.
+func (c ChainStoreExtend) cacheOutputs(block *Block) {
+	for _, tx := range block.Transactions {
+		for _, input := range tx.Inputs {
+			c.outputs.remove(input.Previous)
+		}
+		hash := tx.Hash()
+		for i, output := range tx.Outputs {
+			c.outputs.add(OutPoint{TxID: hash, Index: uint16(i)}, output)
+		}
+	}
+}
+
+// referOutput finds the output an input spends, looking in the pool first as
+// it may not be confirmed yet, then in the output cache and last in the
+// chain store. Only the indexing of blocks passes the output cache as
+// outputs, the lookups of the pool and of the verifier would evict the
+// outputs the next blocks spend and blur its hit rate.
+func (c ChainStoreExtend) referOutput(outpoint OutPoint, pool txPool, outputs *outputCache) (*Output, error) {
+	if tx, ok := pool[outpoint.TxID]; ok {
+		return txOutput(tx, outpoint)
+	}
+	if outputs != nil {
+		if output, ok := outputs.get(outpoint); ok {
+			return output, nil
+		}
+	}
+	tx, _, err := c.GetTransaction(outpoint.TxID)
+	if err == leveldb.ErrNotFound {
+		return nil, &missingOutputError{outpoint}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return txOutput(tx, outpoint)
+}
+
+func txOutput(tx *Transaction, outpoint OutPoint) (*Output, error) {
+	if int(outpoint.Index) >= len(tx.Outputs) {
+		return nil, &missingOutputError{outpoint}
+	}
+	return tx.Outputs[outpoint.Index], nil
+}
+
+// missingOutputError is an input spending an output the chain does not
+// have, a fault of the transaction rather than of the store.
+type missingOutputError struct {
+	outpoint OutPoint
+}
+
+func (e *missingOutputError) Error() string {
+	return fmt.Sprintf("output %d of transaction %s not found", e.outpoint.Index, e.outpoint.TxID)
+}
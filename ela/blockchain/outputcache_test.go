@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_OutputCacheEviction(t *testing.T) {
+	oc := newOutputCache(2)
+	outpoint := func(n byte) types2.OutPoint {
+		return types2.OutPoint{TxID: common.Uint256{n}}
+	}
+	for n := byte(1); n <= 2; n++ {
+		oc.add(outpoint(n), &types2.Output{Value: common.Fixed64(n)})
+	}
+	// using the first output makes the second the least recently used
+	if output, ok := oc.get(outpoint(1)); !ok || output.Value != 1 {
+		t.Fatalf("expect output 1 cached, got %v", output)
+	}
+	oc.add(outpoint(3), &types2.Output{Value: 3})
+	if _, ok := oc.get(outpoint(2)); ok {
+		t.Error("expect output 2 evicted")
+	}
+	oc.remove(outpoint(3))
+	if _, ok := oc.get(outpoint(3)); ok {
+		t.Error("expect output 3 removed")
+	}
+	stats := oc.stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Size != 1 || stats.HitRate != 1.0/3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func Test_OutputCacheIndexing(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, _ := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 300), testOutput(alice, 690))
+	b := testBlock(0, coinbase)
+	chain.connect(b)
+	if err := c.persistTxHistory(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// the spent output is resolved without the chain store
+	delete(chain.txs, coinbase.Hash())
+	b = testBlock(1, pay)
+	chain.connect(b)
+	if err := c.persistTxHistory(b); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.GetTxHistory(bobAddr)) != 1 {
+		t.Fatal("expect the history of the transfer")
+	}
+	stats := c.GetOutputCacheStats()
+	if stats.Hits != 1 || stats.Misses != 0 || stats.Size != 2 {
+		t.Errorf("expect one hit and the outputs of the transfer cached, got %+v", stats)
+	}
+
+	// neither the pool nor the verifier goes through the cache
+	refund := testTransfer([]*types2.Input{testInput(pay, 0)}, testOutput(alice, 290))
+	c.SyncPendingTransactions(pendingPool(refund))
+	if len(c.GetPendingTxHistory(bobAddr)) != 1 {
+		t.Fatal("expect the pending history of the refund")
+	}
+	if _, err := c.blockTxHistory(b, nil); err == nil {
+		t.Error("expect the verifier to read the spent output from the chain store")
+	}
+	if after := c.GetOutputCacheStats(); after != stats {
+		t.Errorf("expect the cache untouched, got %+v instead of %+v", after, stats)
+	}
+}
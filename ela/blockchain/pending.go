@@ -0,0 +1,146 @@
+package blockchain
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	common2 "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// pendingPollInterval is how often the pending rows are synced with the
+// pool when no change of the pool wakes the watcher.
+const pendingPollInterval = time.Second
+
+// txPool holds unconfirmed transactions by hash.
+type txPool map[common2.Uint256]*Transaction
+
+// TxPool is the transaction pool the pending rows follow.
+type TxPool interface {
+	GetTransactionPool(bool) map[common2.Uint256]*Transaction
+}
+
+// pendingTxHistory keeps the history rows of the transactions waiting in
+// the transaction pool, so each of them is only built once.
+type pendingTxHistory struct {
+	sync.RWMutex
+	rows map[common2.Uint256][]types.TransactionHistory
+	wake chan struct{}
+	stop chan struct{}
+}
+
+func newPendingTxHistory() *pendingTxHistory {
+	return &pendingTxHistory{
+		rows: make(map[common2.Uint256][]types.TransactionHistory),
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+}
+
+// WatchTxPool keeps the pending rows in line with the pool from a goroutine
+// of its own until the store is closed. The pool is synced each time
+// OnTxPoolChanged is called, and every pendingPollInterval to catch the
+// transactions relayed by peers, which the pool tells no listener about.
+func (c ChainStoreExtend) WatchTxPool(pool TxPool) {
+	go c.watchTxPool(pool)
+}
+
+// OnTxPoolChanged tells the watcher that transactions entered or left the
+// pool. It does not wait for the sync, so the path changing the pool is not
+// held up by building the rows.
+func (c ChainStoreExtend) OnTxPoolChanged() {
+	select {
+	case c.pending.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c ChainStoreExtend) watchTxPool(pool TxPool) {
+	ticker := time.NewTicker(pendingPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.pending.wake:
+		case <-ticker.C:
+		case <-c.pending.stop:
+			return
+		}
+		c.SyncPendingTransactions(pool.GetTransactionPool(false))
+	}
+}
+
+// SyncPendingTransactions brings the pending rows in line with the
+// transaction pool: rows of transactions that left it are dropped and rows
+// of new ones are built, dated the moment they are first seen, and passed
+// to the history listeners.
+func (c ChainStoreExtend) SyncPendingTransactions(pool map[common2.Uint256]*Transaction) {
+	c.notifyTxHistory(c.syncPendingTransactions(pool))
+}
+
+// syncPendingTransactions returns the rows built for the transactions new
+// to the pool.
+func (c ChainStoreExtend) syncPendingTransactions(pool txPool) []types.TransactionHistory {
+	c.pending.Lock()
+	defer c.pending.Unlock()
+	for hash := range c.pending.rows {
+		if _, ok := pool[hash]; !ok {
+			delete(c.pending.rows, hash)
+		}
+	}
+	var added []types.TransactionHistory
+	now := uint64(time.Now().Unix())
+	for hash, tx := range pool {
+		if _, ok := c.pending.rows[hash]; ok || tx.TxType == CoinBase {
+			continue
+		}
+		// confirmed transactions linger until the pool is cleaned
+		if _, _, err := c.GetTransaction(hash); err == nil {
+			continue
+		}
+		rows, err := c.transferTxHistory(tx, 0, now, pool, nil)
+		if err != nil {
+			log.Debugf("skip pending transaction %s: %s", hash, err)
+			continue
+		}
+		for i := range rows {
+			rows[i].Status = types.TxStatusPending
+		}
+		c.pending.rows[hash] = rows
+		added = append(added, rows...)
+	}
+	return added
+}
+
+// GetPendingTxHistory returns the pending rows of an address, oldest first.
+func (c ChainStoreExtend) GetPendingTxHistory(address string) types.TransactionHistorySorter {
+	c.pending.RLock()
+	defer c.pending.RUnlock()
+	txhs := make(types.TransactionHistorySorter, 0)
+	for _, rows := range c.pending.rows {
+		for _, txh := range rows {
+			if txh.Address == address {
+				txhs = append(txhs, txh)
+			}
+		}
+	}
+	sort.Slice(txhs, func(i, j int) bool {
+		if txhs[i].CreateTime != txhs[j].CreateTime {
+			return txhs[i].CreateTime < txhs[j].CreateTime
+		}
+		return txhs[i].Txid < txhs[j].Txid
+	})
+	return txhs
+}
+
+// promotePending drops the pending rows of the transactions of a block once
+// their confirmed rows are stored.
+func (c ChainStoreExtend) promotePending(block *Block) {
+	c.pending.Lock()
+	defer c.pending.Unlock()
+	for _, tx := range block.Transactions {
+		delete(c.pending.rows, tx.Hash())
+	}
+}
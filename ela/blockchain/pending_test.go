@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	"github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func pendingPool(txs ...*types2.Transaction) map[common.Uint256]*types2.Transaction {
+	pool := make(map[common.Uint256]*types2.Transaction)
+	for _, tx := range txs {
+		pool[tx.Hash()] = tx
+	}
+	return pool
+}
+
+func Test_PendingTxHistory(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	carol, carolAddr := testAddress(3)
+
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	genesis := testBlock(0, coinbase)
+	chain.connect(genesis)
+	if err := c.persistTxHistory(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 600), testOutput(alice, 390))
+	chained := testTransfer([]*types2.Input{testInput(pay, 0)}, testOutput(carol, 590))
+	c.SyncPendingTransactions(pendingPool(pay, chained))
+
+	rows := c.GetPendingTxHistory(aliceAddr)
+	if len(rows) != 1 || rows[0].Type != SPEND || rows[0].Value != 610 || rows[0].Fee != 10 ||
+		rows[0].Height != 0 || rows[0].Status != types.TxStatusPending {
+		t.Errorf("unexpected pending rows of alice %+v", rows)
+	}
+	if rows := c.GetPendingTxHistory(bobAddr); len(rows) != 2 {
+		t.Errorf("expect bob to receive and spend, got %+v", rows)
+	}
+	if rows := c.GetPendingTxHistory(carolAddr); len(rows) != 1 || rows[0].Value != 590 {
+		t.Errorf("expect carol to receive 590, got %+v", rows)
+	}
+
+	// the chained transaction is evicted from the pool
+	c.SyncPendingTransactions(pendingPool(pay))
+	if rows := c.GetPendingTxHistory(carolAddr); len(rows) != 0 {
+		t.Errorf("expect no pending rows of carol, got %+v", rows)
+	}
+
+	block := testBlock(1, testCoinbase(1, testOutput(alice, 1)), pay)
+	chain.connect(block)
+	if err := c.persistTxHistory(block); err != nil {
+		t.Fatal(err)
+	}
+	if rows := c.GetPendingTxHistory(bobAddr); len(rows) != 0 {
+		t.Errorf("expect confirmed rows to leave the pending ones, got %+v", rows)
+	}
+	// the pool still holds the transaction until it is cleaned
+	c.SyncPendingTransactions(pendingPool(pay))
+	if rows := c.GetPendingTxHistory(bobAddr); len(rows) != 0 {
+		t.Errorf("expect a confirmed transaction not to turn pending, got %+v", rows)
+	}
+	for _, txh := range c.GetTxHistory(bobAddr) {
+		if txh.Status != "" {
+			t.Errorf("expect confirmed rows without status, got %+v", txh)
+		}
+	}
+}
+
+// testTxPool is a transaction pool changed by the test.
+type testTxPool struct {
+	sync.Mutex
+	txs map[common.Uint256]*types2.Transaction
+}
+
+func (p *testTxPool) set(txs ...*types2.Transaction) {
+	p.Lock()
+	defer p.Unlock()
+	p.txs = pendingPool(txs...)
+}
+
+func (p *testTxPool) GetTransactionPool(bool) map[common.Uint256]*types2.Transaction {
+	p.Lock()
+	defer p.Unlock()
+	return p.txs
+}
+
+// pendingListener hands the rows it is told about to the test.
+type pendingListener chan []types.TransactionHistory
+
+func (l pendingListener) OnTxHistory(txhs []types.TransactionHistory) { l <- txhs }
+
+func Test_WatchTxPool(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, _ := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	genesis := testBlock(0, coinbase)
+	chain.connect(genesis)
+	if err := c.persistTxHistory(genesis); err != nil {
+		t.Fatal(err)
+	}
+	listener := make(pendingListener, 10)
+	c.RegisterHistoryListener(listener)
+	pool := &testTxPool{}
+	c.WatchTxPool(pool)
+	defer close(c.pending.stop)
+
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 600), testOutput(alice, 390))
+	pool.set(pay)
+	c.OnTxPoolChanged()
+	select {
+	case rows := <-listener:
+		if len(rows) != 2 || rows[0].Status != types.TxStatusPending {
+			t.Errorf("expect the pending rows of the transaction, got %+v", rows)
+		}
+	case <-time.After(pendingPollInterval / 2):
+		t.Fatal("expect the change of the pool to be synced before the poll")
+	}
+	if rows := c.GetPendingTxHistory(bobAddr); len(rows) != 1 {
+		t.Errorf("expect a pending row of bob, got %+v", rows)
+	}
+}
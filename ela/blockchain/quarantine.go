@@ -0,0 +1,209 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	common2 "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+)
+
+const (
+	// maxIndexAttempts is the number of times a block is tried before it is
+	// quarantined.
+	maxIndexAttempts = 5
+	retryBaseDelay   = 5 * time.Second
+	retryMaxDelay    = 5 * time.Minute
+)
+
+// QuarantinedBlock is a block that failed to be indexed maxIndexAttempts
+// times. The checkpoint moved past it without its rows so the blocks after
+// it are indexed, until it is retried. Meanwhile the balances, summaries and
+// rich list built after it miss its changes, see QuarantinedHeights.
+type QuarantinedBlock struct {
+	Height   uint32 `json:"height"`
+	Attempts uint32 `json:"attempts"`
+	Error    string `json:"error"`
+	Time     int64  `json:"time"`
+}
+
+// Serialize writes the block without its height, which is part of the key.
+func (q *QuarantinedBlock) Serialize(w io.Writer) error {
+	if err := common2.WriteUint32(w, q.Attempts); err != nil {
+		return err
+	}
+	if err := common2.WriteVarString(w, q.Error); err != nil {
+		return err
+	}
+	return common2.WriteUint64(w, uint64(q.Time))
+}
+
+func (q *QuarantinedBlock) Deserialize(r io.Reader) error {
+	var err error
+	if q.Attempts, err = common2.ReadUint32(r); err != nil {
+		return err
+	}
+	if q.Error, err = common2.ReadVarString(r); err != nil {
+		return err
+	}
+	t, err := common2.ReadUint64(r)
+	q.Time = int64(t)
+	return err
+}
+
+// indexFailure is the work the loop failed to do, retried with an
+// exponential backoff. Only the loop touches it.
+type indexFailure struct {
+	now      func() time.Time
+	failing  bool
+	height   uint32
+	attempts uint32
+	next     time.Time
+}
+
+func newIndexFailure() *indexFailure {
+	return &indexFailure{now: time.Now}
+}
+
+// waiting reports whether the failed work is not due for a retry yet.
+func (f *indexFailure) waiting() bool {
+	return f.failing && f.now().Before(f.next)
+}
+
+func (f *indexFailure) clear() {
+	f.failing = false
+	f.attempts = 0
+}
+
+// retryDelay is the wait after work failed a number of times.
+func retryDelay(attempts uint32) time.Duration {
+	delay := retryBaseDelay << (attempts - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// indexFailed schedules the retry of failed work. A block failing
+// maxIndexAttempts times in a row is quarantined, failures of the store are
+// retried until they stop.
+func (c ChainStoreExtend) indexFailed(height uint32, err error) {
+	f := c.failure
+	if blockErr, ok := err.(*blockError); ok {
+		height = blockErr.height
+	}
+	if !f.failing || f.height != height {
+		f.failing = true
+		f.height = height
+		f.attempts = 0
+	}
+	f.attempts++
+	if _, ok := err.(*blockError); ok && f.attempts >= maxIndexAttempts {
+		log.Errorf("quarantine block at height %d after %d attempts: %s", height, f.attempts, err)
+		qErr := c.quarantine(height, f.attempts, err)
+		if qErr == nil {
+			f.clear()
+			return
+		}
+		log.Error("quarantine failed: ", qErr)
+	}
+	delay := retryDelay(f.attempts)
+	f.next = f.now().Add(delay)
+	log.Warnf("work at height %d failed %d times, retry in %s: %s", height, f.attempts, delay, err)
+}
+
+// key: DataQuarantinePrefix + height
+func quarantineKey(height uint32) []byte {
+	key := make([]byte, 5)
+	key[0] = byte(DataQuarantinePrefix)
+	binary.BigEndian.PutUint32(key[1:], height)
+	return key
+}
+
+// quarantine records a block that cannot be indexed and moves the
+// checkpoint past it, with an empty height index entry so a rollback goes
+// through it.
+func (c ChainStoreExtend) quarantine(height uint32, attempts uint32, cause error) error {
+	if indexed, ok := c.getIndexedHeight(); ok && indexed+1 != height || !ok && height != 0 {
+		return fmt.Errorf("block at height %d is not the next to index", height)
+	}
+	q := &QuarantinedBlock{
+		Height:   height,
+		Attempts: attempts,
+		Error:    cause.Error(),
+		Time:     c.failure.now().Unix(),
+	}
+	value := new(bytes.Buffer)
+	if err := q.Serialize(value); err != nil {
+		return err
+	}
+	c.begin()
+	c.BatchPut(quarantineKey(height), value.Bytes())
+	if err := c.persistHeightIndex(height, nil); err != nil {
+		c.rollback()
+		return err
+	}
+	c.persistIndexedHeight(height)
+	if err := c.commit(); err != nil {
+		c.rollback()
+		return err
+	}
+	return nil
+}
+
+// GetQuarantine returns the quarantined blocks, lowest first.
+func (c ChainStoreExtend) GetQuarantine() ([]QuarantinedBlock, error) {
+	iter := c.NewIterator([]byte{byte(DataQuarantinePrefix)})
+	defer iter.Release()
+	blocks := make([]QuarantinedBlock, 0)
+	for iter.Next() {
+		var q QuarantinedBlock
+		if err := q.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+			return nil, err
+		}
+		q.Height = binary.BigEndian.Uint32(iter.Key()[1:])
+		blocks = append(blocks, q)
+	}
+	return blocks, nil
+}
+
+// QuarantinedHeights returns the heights of the quarantined blocks up to a
+// height, lowest first. The cumulative entries built at or above one of them
+// are incomplete.
+func (c ChainStoreExtend) QuarantinedHeights(to uint32) []uint32 {
+	iter := c.NewIterator([]byte{byte(DataQuarantinePrefix)})
+	defer iter.Release()
+	var heights []uint32
+	for iter.Next() {
+		height := binary.BigEndian.Uint32(iter.Key()[1:])
+		if height > to {
+			break
+		}
+		heights = append(heights, height)
+	}
+	return heights
+}
+
+// RetryQuarantined queues a quarantined block to be indexed again, along
+// with every block above it. It reports false if the block is not
+// quarantined. The entry is removed once the block is indexed.
+func (c ChainStoreExtend) RetryQuarantined(height uint32) (bool, error) {
+	if _, err := c.Get(quarantineKey(height)); err != nil {
+		return false, nil
+	}
+	err := c.logWork(height, func(w *work) {
+		w.Flags = workRollback | workIndex
+	})
+	if err != nil {
+		return false, err
+	}
+	if tip := c.GetHeight(); tip > height {
+		err = c.logWork(tip, func(w *work) {
+			w.Flags |= workIndex
+		})
+	}
+	return err == nil, err
+}
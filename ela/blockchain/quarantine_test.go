@@ -0,0 +1,124 @@
+package blockchain
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_RollbackDiscardsBatch(t *testing.T) {
+	c := newChainStoreEx(newTestChainStore(), newMemStore(t))
+	c.begin()
+	c.BatchPut([]byte{byte(DataTxHistoryPrefix)}, []byte{0x01})
+	c.rollback()
+	if err := c.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get([]byte{byte(DataTxHistoryPrefix)}); err == nil {
+		t.Error("expect the discarded write not to be committed")
+	}
+}
+
+func Test_QuarantineBlock(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	now := time.Unix(1500000000, 0)
+	c.failure.now = func() time.Time { return now }
+	alice, _ := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	// the transaction spent at height 1 is missing from the chain store
+	orphan := testCoinbase(9, testOutput(alice, 500))
+	pay := testTransfer([]*types2.Input{testInput(orphan, 0)}, testOutput(bob, 400))
+	blocks := []*types2.Block{
+		testBlock(0, testCoinbase(0, testOutput(alice, 100))),
+		testBlock(1, testCoinbase(1, testOutput(alice, 100)), pay),
+		testBlock(2, testCoinbase(2, testOutput(alice, 100))),
+	}
+	for _, b := range blocks {
+		chain.connect(b)
+		c.AddTask(b)
+	}
+
+	for attempt := uint32(1); attempt < maxIndexAttempts; attempt++ {
+		c.processWorkLog(math.MaxUint32)
+		if lag := c.GetIndexLag(); lag.IndexedHeight != 0 || c.failure.attempts != attempt {
+			t.Fatalf("expect attempt %d to stop at height 0, got %+v", attempt, lag)
+		}
+		// nothing is tried before the backoff elapses
+		c.processWorkLog(math.MaxUint32)
+		if c.failure.attempts != attempt {
+			t.Fatalf("expect no retry before the backoff, got %d attempts", c.failure.attempts)
+		}
+		now = now.Add(retryDelay(attempt))
+	}
+	c.processWorkLog(math.MaxUint32)
+	quarantined, err := c.GetQuarantine()
+	if err != nil || len(quarantined) != 1 || quarantined[0].Height != 1 ||
+		quarantined[0].Attempts != maxIndexAttempts {
+		t.Fatalf("expect height 1 quarantined, got %+v %v", quarantined, err)
+	}
+	c.processWorkLog(math.MaxUint32)
+	lag := c.GetIndexLag()
+	if lag.IndexedHeight != 2 || lag.Queued != 0 {
+		t.Fatalf("expect the blocks after the quarantined one indexed, got %+v", lag)
+	}
+	if !reflect.DeepEqual(lag.Quarantined, []uint32{1}) {
+		t.Errorf("expect height 1 reported quarantined, got %v", lag.Quarantined)
+	}
+	if heights := c.QuarantinedHeights(0); len(heights) != 0 {
+		t.Errorf("expect nothing quarantined up to height 0, got %v", heights)
+	}
+
+	chain.txs[orphan.Hash()] = orphan
+	if ok, err := c.RetryQuarantined(0); ok || err != nil {
+		t.Errorf("expect height 0 not to be quarantined, got %v %v", ok, err)
+	}
+	if ok, err := c.RetryQuarantined(1); !ok || err != nil {
+		t.Fatalf("expect height 1 to be retried, got %v %v", ok, err)
+	}
+	c.processWorkLog(math.MaxUint32)
+	if quarantined, _ := c.GetQuarantine(); len(quarantined) != 0 {
+		t.Errorf("expect an empty quarantine, got %+v", quarantined)
+	}
+	if lag := c.GetIndexLag(); lag.IndexedHeight != 2 || lag.Queued != 0 || len(lag.Quarantined) != 0 {
+		t.Errorf("expect the index rebuilt to height 2, got %+v", lag)
+	}
+	if len(c.GetTxHistory(bobAddr)) != 1 {
+		t.Error("expect the history of the retried block")
+	}
+}
+
+func Test_StoreFailureNotQuarantined(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	now := time.Unix(1500000000, 0)
+	c.failure.now = func() time.Time { return now }
+	alice, aliceAddr := testAddress(1)
+	chain.connect(testBlock(0, testCoinbase(0, testOutput(alice, 100))))
+	c.AddTask(chain.blocks[0])
+
+	chain.readErr = errors.New("read failed")
+	for attempt := uint32(1); attempt <= 2*maxIndexAttempts; attempt++ {
+		c.processWorkLog(math.MaxUint32)
+		if c.failure.attempts != attempt {
+			t.Fatalf("expect attempt %d, got %d", attempt, c.failure.attempts)
+		}
+		now = now.Add(retryDelay(attempt))
+	}
+	if quarantined, _ := c.GetQuarantine(); len(quarantined) != 0 {
+		t.Fatalf("expect a failing store not to quarantine blocks, got %+v", quarantined)
+	}
+
+	chain.readErr = nil
+	c.processWorkLog(math.MaxUint32)
+	if lag := c.GetIndexLag(); !lag.Indexed || lag.IndexedHeight != 0 || lag.Queued != 0 {
+		t.Errorf("expect the block indexed once the store recovers, got %+v", lag)
+	}
+	if len(c.GetTxHistory(aliceAddr)) != 1 {
+		t.Error("expect the history of the block")
+	}
+}
@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"fmt"
+
+	. "github.com/elastos/Elastos.ELA/blockchain"
+	"github.com/elastos/Elastos.ELA/common/log"
+)
+
+const (
+	// wipeBatchSize is the number of entries deleted per batch commit when
+	// the index is wiped before a rebuild.
+	wipeBatchSize = 10000
+	// reindexLogInterval is the number of blocks between progress messages.
+	reindexLogInterval = 1000
+)
+
+// ReindexTask asks the extended store to index every block of the main chain
+// store that has not been indexed yet. With FromGenesis set the existing
+// transaction history is wiped first and rebuilt from height 0.
+type ReindexTask struct {
+	FromGenesis bool
+}
+
+// reindex handles a ReindexTask. It returns the close request if CloseEx was
+// called while blocks were being indexed.
+func (c ChainStoreExtend) reindex(task *ReindexTask) chan bool {
+	if task.FromGenesis {
+		log.Info("wipe transaction history before reindex")
+		if err := c.wipeTxHistory(); err != nil {
+			log.Error("wipe transaction history failed:", err)
+			return nil
+		}
+	}
+	closed, err := c.catchUp(c.GetHeight())
+	if err != nil {
+		log.Error("reindex stopped: ", err)
+	}
+	return closed
+}
+
+// blockError is the failure to index the block at a height because of its
+// content, such as an input spending a missing output. Retrying does not
+// fix it, as opposed to a failure of the store.
+type blockError struct {
+	height uint32
+	err    error
+}
+
+func (e *blockError) Error() string {
+	return fmt.Sprintf("index block at height %d: %s", e.height, e.err)
+}
+
+// catchUp indexes the blocks between the stored checkpoint and the given
+// height. The checkpoint is committed together with every block, so an
+// interrupted catch up resumes from where it stopped. It returns the close
+// request if CloseEx was called meanwhile.
+func (c ChainStoreExtend) catchUp(to uint32) (chan bool, error) {
+	var from uint32
+	if height, ok := c.getIndexedHeight(); ok {
+		from = height + 1
+	}
+	if from > to {
+		return nil, nil
+	}
+	log.Infof("index transaction history from height %d to %d", from, to)
+	for height := from; height <= to; height++ {
+		select {
+		case closed := <-c.quitEx:
+			log.Infof("transaction history index stopped at height %d", height-1)
+			return closed, nil
+		default:
+		}
+		hash, err := c.GetBlockHash(height)
+		if err != nil {
+			return nil, fmt.Errorf("get block hash at height %d: %s", height, err)
+		}
+		block, err := c.GetBlock(hash)
+		if err != nil {
+			return nil, fmt.Errorf("get block at height %d: %s", height, err)
+		}
+		if err := c.persistTxHistory(block); err != nil {
+			if _, ok := err.(*missingOutputError); ok {
+				return nil, &blockError{height, err}
+			}
+			return nil, fmt.Errorf("index block at height %d: %s", height, err)
+		}
+		if height%reindexLogInterval == 0 {
+			log.Infof("transaction history indexed to height %d, output cache hit rate %.2f", height,
+				c.outputs.stats().HitRate)
+		}
+	}
+	log.Infof("transaction history index caught up at height %d", to)
+	return nil, nil
+}
+
+// indexPrefixes are the prefixes of every entry derived from blocks, which
+// are wiped before the index is rebuilt.
+var indexPrefixes = []DataEntryPrefix{
+	DataTxHistoryPrefix,
+	DataHeightIndexPrefix,
+	DataCrossChainDepositPrefix,
+	DataCrossChainWithdrawalPrefix,
+	DataBalancePrefix,
+	DataAddressSummaryPrefix,
+	DataRichListPrefix,
+	DataRichListHoldersPrefix,
+	DataRichListBucketPrefix,
+	DataSpentOutputPrefix,
+	DataQuarantinePrefix,
+}
+
+// wipeTxHistory removes every entry derived from blocks, the height index
+// and the checkpoint.
+func (c ChainStoreExtend) wipeTxHistory() error {
+	for _, prefix := range indexPrefixes {
+		if err := c.deletePrefix(prefix); err != nil {
+			return err
+		}
+	}
+	return c.Delete([]byte{byte(DataIndexedHeightPrefix)})
+}
+
+// deletePrefix removes every entry under the given prefix.
+func (c ChainStoreExtend) deletePrefix(prefix DataEntryPrefix) error {
+	iter := c.NewIterator([]byte{byte(prefix)})
+	defer iter.Release()
+	count := 0
+	c.NewBatch()
+	for iter.Next() {
+		key := make([]byte, len(iter.Key()))
+		copy(key, iter.Key())
+		c.BatchDelete(key)
+		count++
+		if count%wipeBatchSize == 0 {
+			if err := c.BatchCommit(); err != nil {
+				return err
+			}
+			c.NewBatch()
+		}
+	}
+	if err := c.BatchCommit(); err != nil {
+		return err
+	}
+	log.Debugf("%d entries removed under prefix 0x%x", count, byte(prefix))
+	return nil
+}
@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	"github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// heightListener records the height of every block notified, and asks the
+// store to close once a given height is indexed.
+type heightListener struct {
+	c       ChainStoreExtend
+	stopAt  uint32
+	stop    bool
+	heights []uint32
+	closed  chan bool
+}
+
+func (l *heightListener) OnTxHistory(txhs []types.TransactionHistory) {
+	height := uint32(txhs[0].Height)
+	l.heights = append(l.heights, height)
+	if l.stop && height == l.stopAt {
+		l.c.quitEx <- l.closed
+	}
+}
+
+// testChain connects blocks moving value between two addresses.
+func testChain(chain *testChainStore, n uint32) {
+	alice, _ := testAddress(1)
+	bob, _ := testAddress(2)
+	value := common.Fixed64(1000)
+	prev := testCoinbase(0, testOutput(alice, value))
+	chain.connect(testBlock(0, prev))
+	for height := uint32(1); height < n; height++ {
+		value -= 20
+		pay := testTransfer([]*types2.Input{testInput(prev, 0)}, testOutput(alice, value), testOutput(bob, 10))
+		chain.connect(testBlock(height, testCoinbase(height, testOutput(bob, 1)), pay))
+		prev = pay
+	}
+}
+
+func Test_CatchUpResumes(t *testing.T) {
+	chain := newTestChainStore()
+	testChain(chain, 5)
+	c := newChainStoreEx(chain, newMemStore(t))
+	listener := &heightListener{c: c, stopAt: 2, stop: true, closed: make(chan bool, 1)}
+	c.RegisterHistoryListener(listener)
+
+	closed, err := c.catchUp(chain.GetHeight())
+	if err != nil || closed != listener.closed {
+		t.Fatalf("expect the catch up to stop on close, got %v %v", closed, err)
+	}
+	if indexed, ok := c.getIndexedHeight(); !ok || indexed != 2 {
+		t.Fatalf("expect the checkpoint at height 2, got %d %v", indexed, ok)
+	}
+	if _, err := c.getHeightIndex(3); err == nil {
+		t.Fatal("expect nothing indexed above the checkpoint")
+	}
+
+	listener.stop = false
+	listener.heights = nil
+	if closed, err := c.catchUp(chain.GetHeight()); closed != nil || err != nil {
+		t.Fatalf("expect the catch up to finish, got %v %v", closed, err)
+	}
+	if !reflect.DeepEqual(listener.heights, []uint32{3, 4}) {
+		t.Errorf("expect the catch up to resume at height 3, got %v", listener.heights)
+	}
+	if indexed, _ := c.getIndexedHeight(); indexed != 4 {
+		t.Errorf("expect the checkpoint at the tip, got %d", indexed)
+	}
+}
+
+func Test_ReindexFromGenesis(t *testing.T) {
+	chain := newTestChainStore()
+	testChain(chain, 5)
+	c := newChainStoreEx(chain, newMemStore(t))
+	if closed := c.reindex(&ReindexTask{}); closed != nil {
+		t.Fatal("unexpected close")
+	}
+	indexed := dumpIndex(c)
+	if len(indexed) == 0 {
+		t.Fatal("expect derived entries")
+	}
+
+	// entries left by an older index are wiped
+	for _, prefix := range indexPrefixes {
+		c.Put([]byte{byte(prefix), 0xff, 0xff}, []byte{0x01})
+	}
+	if closed := c.reindex(&ReindexTask{FromGenesis: true}); closed != nil {
+		t.Fatal("unexpected close")
+	}
+	if rebuilt := dumpIndex(c); !reflect.DeepEqual(rebuilt, indexed) {
+		t.Errorf("expect identical entries after the rebuild, got %d entries instead of %d",
+			len(rebuilt), len(indexed))
+	}
+	if height, ok := c.getIndexedHeight(); !ok || height != 4 {
+		t.Errorf("expect the checkpoint at the tip, got %d %v", height, ok)
+	}
+}
+
+func Test_WipeTxHistory(t *testing.T) {
+	chain := newTestChainStore()
+	testChain(chain, 3)
+	c := newChainStoreEx(chain, newMemStore(t))
+	if closed, err := c.catchUp(chain.GetHeight()); closed != nil || err != nil {
+		t.Fatal(closed, err)
+	}
+	if err := c.wipeTxHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if entries := dumpIndex(c); len(entries) != 0 {
+		t.Errorf("expect every derived entry wiped, got %d", len(entries))
+	}
+	if _, ok := c.getIndexedHeight(); ok {
+		t.Error("expect the checkpoint wiped")
+	}
+}
+
+// dumpIndex returns every entry derived from blocks. The keys of a height
+// index entry are sorted, their order follows the rows of a transaction.
+func dumpIndex(c ChainStoreExtend) map[string]string {
+	entries := make(map[string]string)
+	for _, prefix := range indexPrefixes {
+		iter := c.NewIterator([]byte{byte(prefix)})
+		for iter.Next() {
+			entries[string(iter.Key())] = string(iter.Value())
+		}
+		iter.Release()
+	}
+	for key := range entries {
+		if key[0] != byte(DataHeightIndexPrefix) || len(key) != 5 {
+			continue
+		}
+		keys, _ := c.getHeightIndex(binary.BigEndian.Uint32([]byte(key[1:])))
+		sorted := make([]string, 0, len(keys))
+		for _, k := range keys {
+			sorted = append(sorted, string(k))
+		}
+		sort.Strings(sorted)
+		entries[key] = strings.Join(sorted, ",")
+	}
+	return entries
+}
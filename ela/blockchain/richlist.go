@@ -0,0 +1,409 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/common"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	common2 "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// richListBucketBits is the number of most significant bits of a balance
+// naming its bucket. The holders of a bucket are counted, so a rank or an
+// offset is found by summing the counts of the buckets above it and only
+// walking the entries of its own bucket.
+const richListBucketBits = 8
+
+// RichListEntry is the balance of an address and its 1-based rank among
+// all addresses holding a balance.
+type RichListEntry struct {
+	Rank    uint64
+	Address string
+	Balance uint64
+}
+
+// richListCounts are the number of holders and the changes of the holder
+// counts of the buckets made by the moves of one batch.
+type richListCounts struct {
+	holders uint64
+	buckets map[uint64]int64
+}
+
+func (c ChainStoreExtend) newRichListCounts() *richListCounts {
+	return &richListCounts{holders: c.getRichListHolders(), buckets: make(map[uint64]int64)}
+}
+
+// updateRichList moves the addresses of a block to their new balance in
+// the rich list. Entries are not listed in the height index, a rollback
+// restores them with rollbackRichList.
+func (c ChainStoreExtend) updateRichList(block *Block, txhs []types.TransactionHistory) error {
+	addresses := common.NewStringSet()
+	rows := make(map[string][]*types.TransactionHistory)
+	for i := range txhs {
+		addresses.Add(txhs[i].Address)
+		rows[txhs[i].Address] = append(rows[txhs[i].Address], &txhs[i])
+	}
+
+	counts := c.newRichListCounts()
+	for _, address := range addresses.Slice() {
+		previous := new(BalanceSnapshot)
+		if block.Height > 0 {
+			if err := c.loadBalance(address, block.Height-1, previous); err != nil {
+				return err
+			}
+		}
+		next := *previous
+		for _, txh := range rows[address] {
+			next.add(txh)
+		}
+		c.moveRichListEntry(address, previous.Balance, next.Balance, counts)
+	}
+	return c.persistRichListCounts(counts)
+}
+
+// rollbackRichList moves the addresses whose balance snapshots are deleted
+// by a rollback back to their balance at the given height. It must run
+// before the snapshots are deleted.
+func (c ChainStoreExtend) rollbackRichList(addresses *common.StringSet, height uint32, genesis bool) error {
+	counts := c.newRichListCounts()
+	for _, address := range addresses.Slice() {
+		current, final := new(BalanceSnapshot), new(BalanceSnapshot)
+		if err := c.loadBalance(address, math.MaxUint32, current); err != nil {
+			return err
+		}
+		if !genesis {
+			if err := c.loadBalance(address, height, final); err != nil {
+				return err
+			}
+		}
+		c.moveRichListEntry(address, current.Balance, final.Balance, counts)
+	}
+	return c.persistRichListCounts(counts)
+}
+
+// GetRichList returns the holders ordered by balance, largest first. The
+// offset is reached through the bucket counts, only the entries of the
+// bucket it falls in are skipped one by one.
+func (c ChainStoreExtend) GetRichList(offset, limit uint64) ([]RichListEntry, uint64, error) {
+	entries := make([]RichListEntry, 0)
+	start, skip, ok, err := c.seekRichList(offset)
+	if err != nil || !ok {
+		return entries, c.getRichListHolders(), err
+	}
+	iter := c.NewIterator([]byte{byte(DataRichListPrefix)})
+	defer iter.Release()
+	rank := offset - skip
+	for ok := iter.Seek(start); ok && uint64(len(entries)) < limit; ok = iter.Next() {
+		rank++
+		if rank <= offset {
+			continue
+		}
+		address, balance, err := decodeRichListKey(iter.Key())
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, RichListEntry{Rank: rank, Address: address, Balance: balance})
+	}
+	return entries, c.getRichListHolders(), nil
+}
+
+// GetRichListRank returns the rank of an address. It reports false when the
+// address holds no balance. The holders of the buckets above the balance
+// are counted, then the entries of its bucket above it are walked.
+func (c ChainStoreExtend) GetRichListRank(address string) (*RichListEntry, bool, error) {
+	balance := new(BalanceSnapshot)
+	if err := c.loadBalance(address, math.MaxUint32, balance); err != nil {
+		return nil, false, err
+	}
+	if balance.Balance == 0 {
+		return nil, false, nil
+	}
+	return c.rankOf(address, balance.Balance)
+}
+
+// rankOf returns the rank of the entry of an address at a balance.
+func (c ChainStoreExtend) rankOf(address string, balance uint64) (*RichListEntry, bool, error) {
+	key, err := richListKey(address, balance)
+	if err != nil {
+		return nil, false, err
+	}
+	bucket := richListBucket(balance)
+	above, err := c.countRichListAbove(bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	iter := c.NewIterator([]byte{byte(DataRichListPrefix)})
+	defer iter.Release()
+	rank := above + 1
+	for ok := iter.Seek(richListBalanceKey(richListBucketEnd(bucket))); ok &&
+		bytes.Compare(iter.Key(), key) < 0; ok = iter.Next() {
+		rank++
+	}
+	return &RichListEntry{Rank: rank, Address: address, Balance: balance}, true, nil
+}
+
+// countRichListAbove returns the number of holders in the buckets above a
+// bucket.
+func (c ChainStoreExtend) countRichListAbove(bucket uint64) (uint64, error) {
+	iter := c.NewIterator([]byte{byte(DataRichListBucketPrefix)})
+	defer iter.Release()
+	var above uint64
+	for iter.Next() {
+		lower, count, err := decodeRichListBucket(iter.Key(), iter.Value())
+		if err != nil {
+			return 0, err
+		}
+		if lower <= bucket {
+			break
+		}
+		above += count
+	}
+	return above, nil
+}
+
+// seekRichList finds the bucket holding the entry at an offset. It returns
+// the key the bucket starts at and the number of its entries to skip, or
+// false when the offset is past the last holder.
+func (c ChainStoreExtend) seekRichList(offset uint64) ([]byte, uint64, bool, error) {
+	iter := c.NewIterator([]byte{byte(DataRichListBucketPrefix)})
+	defer iter.Release()
+	var above uint64
+	for iter.Next() {
+		lower, count, err := decodeRichListBucket(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if above+count > offset {
+			return richListBalanceKey(richListBucketEnd(lower)), offset - above, true, nil
+		}
+		above += count
+	}
+	return nil, 0, false, nil
+}
+
+// migrateRichList builds the rich list from the last balance snapshot of
+// every address. A store without a checkpoint, as legacy stores are, has
+// its blocks replayed from height 0 by the next catch up, which moves
+// every address into the list: built here as well, each would be counted
+// twice.
+func (c ChainStoreExtend) migrateRichList() error {
+	if _, ok := c.getIndexedHeight(); !ok {
+		return nil
+	}
+	iter := c.NewIterator([]byte{byte(DataBalancePrefix)})
+	defer iter.Release()
+	counts := &richListCounts{buckets: make(map[uint64]int64)}
+	var address string
+	var balance uint64
+	c.NewBatch()
+	flush := func() {
+		if address == "" || balance == 0 {
+			return
+		}
+		c.moveRichListEntry(address, 0, balance, counts)
+	}
+	for iter.Next() {
+		r := bytes.NewReader(iter.Key()[1:])
+		next, err := common2.ReadVarString(r)
+		if err != nil {
+			return err
+		}
+		if next != address {
+			flush()
+			address = next
+		}
+		snapshot := new(BalanceSnapshot)
+		if err := snapshot.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+			return err
+		}
+		balance = snapshot.Balance
+	}
+	flush()
+	if err := c.persistRichListCounts(counts); err != nil {
+		return err
+	}
+	log.Infof("rich list built with %d holders", counts.holders)
+	return c.BatchCommit()
+}
+
+func (c ChainStoreExtend) loadBalance(address string, height uint32, balance *BalanceSnapshot) error {
+	prefix, err := balancePrefix(address)
+	if err != nil {
+		return err
+	}
+	_, err = c.getAddressSnapshot(prefix, height, balance)
+	return err
+}
+
+// moveRichListEntry replaces the entry of an address at its old balance with
+// one at its new balance, and counts the move.
+func (c ChainStoreExtend) moveRichListEntry(address string, from, to uint64, counts *richListCounts) {
+	if from == to {
+		return
+	}
+	if from > 0 {
+		if key, err := richListKey(address, from); err == nil {
+			c.BatchDelete(key)
+			counts.holders--
+			counts.buckets[richListBucket(from)]--
+		}
+	}
+	if to > 0 {
+		if key, err := richListKey(address, to); err == nil {
+			c.BatchPut(key, []byte{})
+			counts.holders++
+			counts.buckets[richListBucket(to)]++
+		}
+	}
+}
+
+// persistRichListCounts writes the number of holders and the bucket counts
+// changed by the moves of the batch.
+func (c ChainStoreExtend) persistRichListCounts(counts *richListCounts) error {
+	c.persistRichListHolders(counts.holders)
+	for lower, delta := range counts.buckets {
+		if delta == 0 {
+			continue
+		}
+		key := richListBucketKey(lower)
+		var count uint64
+		data, err := c.Get(key)
+		if err == nil {
+			_, count, err = decodeRichListBucket(key, data)
+		}
+		if err != nil && err != leveldb.ErrNotFound {
+			return err
+		}
+		count = uint64(int64(count) + delta)
+		if count == 0 {
+			c.BatchDelete(key)
+			continue
+		}
+		value := new(bytes.Buffer)
+		common2.WriteUint64(value, count)
+		c.BatchPut(key, value.Bytes())
+	}
+	return nil
+}
+
+// key: DataRichListHoldersPrefix
+// value: number of addresses holding a balance
+func (c ChainStoreExtend) persistRichListHolders(holders uint64) {
+	value := new(bytes.Buffer)
+	common2.WriteUint64(value, holders)
+	c.BatchPut([]byte{byte(DataRichListHoldersPrefix)}, value.Bytes())
+}
+
+func (c ChainStoreExtend) getRichListHolders() uint64 {
+	data, err := c.Get([]byte{byte(DataRichListHoldersPrefix)})
+	if err != nil {
+		return 0
+	}
+	holders, err := common2.ReadUint64(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	return holders
+}
+
+// key: DataRichListPrefix + (MaxUint64 - balance) + address
+// value: empty
+//
+// The balance is inverted so the largest holders come first.
+func richListKey(address string, balance uint64) ([]byte, error) {
+	key := bytes.NewBuffer(richListBalanceKey(balance))
+	if err := common2.WriteVarString(key, address); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+// richListBalanceKey is the key every entry at a balance starts with.
+func richListBalanceKey(balance uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = byte(DataRichListPrefix)
+	binary.BigEndian.PutUint64(key[1:], math.MaxUint64-balance)
+	return key
+}
+
+// richListBucket returns the lowest balance of the bucket of a balance,
+// the balance with only its richListBucketBits most significant bits kept.
+func richListBucket(balance uint64) uint64 {
+	shift := bits.Len64(balance) - richListBucketBits
+	if shift <= 0 {
+		return balance
+	}
+	return balance >> uint(shift) << uint(shift)
+}
+
+// richListBucketEnd returns the highest balance of a bucket.
+func richListBucketEnd(lower uint64) uint64 {
+	shift := bits.Len64(lower) - richListBucketBits
+	if shift <= 0 {
+		return lower
+	}
+	return lower | (1<<uint(shift) - 1)
+}
+
+// key: DataRichListBucketPrefix + (MaxUint64 - lowest balance of the bucket)
+// value: number of holders with a balance in the bucket
+func richListBucketKey(lower uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = byte(DataRichListBucketPrefix)
+	binary.BigEndian.PutUint64(key[1:], math.MaxUint64-lower)
+	return key
+}
+
+func decodeRichListBucket(key, value []byte) (uint64, uint64, error) {
+	if len(key) != 9 {
+		return 0, 0, errors.New("invalid rich list bucket key")
+	}
+	count, err := common2.ReadUint64(bytes.NewReader(value))
+	if err != nil {
+		return 0, 0, err
+	}
+	return math.MaxUint64 - binary.BigEndian.Uint64(key[1:]), count, nil
+}
+
+// migrateRichListBuckets counts the holders of every bucket of the rich
+// list built before the buckets existed.
+func (c ChainStoreExtend) migrateRichListBuckets() error {
+	if err := c.deletePrefix(DataRichListBucketPrefix); err != nil {
+		return err
+	}
+	iter := c.NewIterator([]byte{byte(DataRichListPrefix)})
+	defer iter.Release()
+	counts := &richListCounts{holders: c.getRichListHolders(), buckets: make(map[uint64]int64)}
+	for iter.Next() {
+		_, balance, err := decodeRichListKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		counts.buckets[richListBucket(balance)]++
+	}
+	c.NewBatch()
+	if err := c.persistRichListCounts(counts); err != nil {
+		return err
+	}
+	log.Infof("rich list buckets counted for %d holders", counts.holders)
+	return c.BatchCommit()
+}
+
+func decodeRichListKey(key []byte) (string, uint64, error) {
+	if len(key) < 10 {
+		return "", 0, errors.New("invalid rich list key")
+	}
+	r := bytes.NewReader(key[9:])
+	address, err := common2.ReadVarString(r)
+	if err != nil {
+		return "", 0, err
+	}
+	return address, math.MaxUint64 - binary.BigEndian.Uint64(key[1:9]), nil
+}
@@ -0,0 +1,221 @@
+package blockchain
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA/blockchain"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func richList(t *testing.T, c ChainStoreExtend) ([]RichListEntry, uint64) {
+	entries, holders, err := c.GetRichList(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries, holders
+}
+
+func Test_RichList(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	carol, carolAddr := testAddress(3)
+
+	coinbase := testCoinbase(0, testOutput(alice, 1000), testOutput(carol, 500))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 600), testOutput(alice, 390))
+	spendAll := testTransfer([]*types2.Input{testInput(coinbase, 1)}, testOutput(bob, 495))
+	var blocks []*types2.Block
+	for h, tx := range []*types2.Transaction{coinbase, pay, spendAll} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	entries, holders := richList(t, c)
+	expect := []RichListEntry{{1, bobAddr, 1095}, {2, aliceAddr, 390}}
+	if !reflect.DeepEqual(entries, expect) || holders != 2 {
+		t.Errorf("expect rich list %+v of 2 holders, got %+v of %d", expect, entries, holders)
+	}
+	if page, _, _ := c.GetRichList(1, 1); !reflect.DeepEqual(page, expect[1:]) {
+		t.Errorf("expect second page %+v, got %+v", expect[1:], page)
+	}
+	rank, ok, err := c.GetRichListRank(aliceAddr)
+	if err != nil || !ok || *rank != expect[1] {
+		t.Errorf("expect alice at %+v, got %+v %v %v", expect[1], rank, ok, err)
+	}
+	if _, ok, _ := c.GetRichListRank(carolAddr); ok {
+		t.Error("expect carol without balance to have no rank")
+	}
+	if err := c.rollbackTxHistory(blocks[1]); err != nil {
+		t.Fatal(err)
+	}
+	entries, holders = richList(t, c)
+	expect = []RichListEntry{{1, aliceAddr, 1000}, {2, carolAddr, 500}}
+	if !reflect.DeepEqual(entries, expect) || holders != 2 {
+		t.Errorf("expect rich list %+v after rollback, got %+v of %d", expect, entries, holders)
+	}
+
+	if err := c.rollbackTxHistory(blocks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if entries, holders := richList(t, c); len(entries) != 0 || holders != 0 {
+		t.Errorf("expect an empty rich list, got %+v of %d", entries, holders)
+	}
+}
+
+func Test_RichListBuckets(t *testing.T) {
+	c := newChainStoreEx(newTestChainStore(), newMemStore(t))
+	var expect []RichListEntry
+	moves := func(fn func(i int) (uint64, uint64)) {
+		c.NewBatch()
+		counts := c.newRichListCounts()
+		for i := 0; i < 600; i++ {
+			from, to := fn(i)
+			c.moveRichListEntry(fmt.Sprintf("E%03d", i), from, to, counts)
+		}
+		if err := c.persistRichListCounts(counts); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.BatchCommit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// balances spread over many buckets, with holders sharing a balance
+	balance := func(i int) uint64 { return uint64(i/2)*uint64(i/2)*7919 + 1 }
+	moves(func(i int) (uint64, uint64) { return 0, balance(i) })
+	// every third holder moves, every fifth one spends it all
+	moves(func(i int) (uint64, uint64) {
+		switch {
+		case i%5 == 0:
+			return balance(i), 0
+		case i%3 == 0:
+			return balance(i), balance(i) * 3
+		}
+		return balance(i), balance(i)
+	})
+
+	all, holders, err := c.GetRichList(0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holders != 480 || uint64(len(all)) != holders {
+		t.Fatalf("expect 480 holders, got %d of %d", len(all), holders)
+	}
+	for i, entry := range all {
+		if entry.Rank != uint64(i+1) || i > 0 && entry.Balance > all[i-1].Balance {
+			t.Fatalf("expect %+v ranked %d in balance order", entry, i+1)
+		}
+		rank, ok, err := c.rankOf(entry.Address, entry.Balance)
+		if err != nil || !ok || *rank != entry {
+			t.Fatalf("expect rank %+v, got %+v %v %v", entry, rank, ok, err)
+		}
+	}
+	for _, offset := range []uint64{0, 1, 37, 255, 256, 300, 479} {
+		page, _, err := c.GetRichList(offset, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		end := offset + 50
+		if end > holders {
+			end = holders
+		}
+		if expect = all[offset:end]; !reflect.DeepEqual(page, expect) {
+			t.Errorf("offset %d: expect %+v, got %+v", offset, expect, page)
+		}
+	}
+	if page, _, err := c.GetRichList(holders, 10); err != nil || len(page) != 0 {
+		t.Errorf("expect an empty page past the last holder, got %+v %v", page, err)
+	}
+
+	// the migration counts the buckets again from the rich list
+	counted := make(map[string][]byte)
+	iter := c.NewIterator([]byte{byte(DataRichListBucketPrefix)})
+	for iter.Next() {
+		counted[string(iter.Key())] = append([]byte{}, iter.Value()...)
+	}
+	iter.Release()
+	if err := c.migrateRichListBuckets(); err != nil {
+		t.Fatal(err)
+	}
+	iter = c.NewIterator([]byte{byte(DataRichListBucketPrefix)})
+	defer iter.Release()
+	n := 0
+	for ; iter.Next(); n++ {
+		if value, ok := counted[string(iter.Key())]; !ok || !reflect.DeepEqual(value, iter.Value()) {
+			t.Errorf("expect bucket %x counted as before", iter.Key())
+		}
+	}
+	if n != len(counted) {
+		t.Errorf("expect %d buckets, got %d", len(counted), n)
+	}
+}
+
+func Test_MigrateRichList(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, _ := testAddress(1)
+	bob, _ := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 600), testOutput(alice, 390))
+	for h, tx := range []*types2.Transaction{coinbase, pay} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect, holders := richList(t, c)
+
+	for _, prefix := range []DataEntryPrefix{DataRichListPrefix, DataRichListHoldersPrefix, DataRichListBucketPrefix} {
+		if err := c.deletePrefix(prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.persistSchemaVersion(schemaVersionSummary); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.checkSchemaVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, n := richList(t, c); !reflect.DeepEqual(entries, expect) || n != holders {
+		t.Errorf("expect migrated rich list %+v of %d, got %+v of %d", expect, holders, entries, n)
+	}
+}
+
+func Test_MigrateRichListThenCatchUp(t *testing.T) {
+	chain := newTestChainStore()
+	testChain(chain, 4)
+	c := newChainStoreEx(chain, newMemStore(t))
+	if closed, err := c.catchUp(chain.GetHeight()); closed != nil || err != nil {
+		t.Fatal(closed, err)
+	}
+	expect, holders := richList(t, c)
+
+	// a legacy store has the history without the rich list nor a checkpoint
+	for _, prefix := range []DataEntryPrefix{DataRichListPrefix, DataRichListHoldersPrefix, DataRichListBucketPrefix} {
+		if err := c.deletePrefix(prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Delete([]byte{byte(DataIndexedHeightPrefix)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.persistSchemaVersion(schemaVersionSummary); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.checkSchemaVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if closed, err := c.catchUp(chain.GetHeight()); closed != nil || err != nil {
+		t.Fatal(closed, err)
+	}
+	if entries, n := richList(t, c); !reflect.DeepEqual(entries, expect) || n != holders {
+		t.Errorf("expect rich list %+v of %d after the replay, got %+v of %d", expect, holders, entries, n)
+	}
+}
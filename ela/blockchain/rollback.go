@@ -0,0 +1,67 @@
+package blockchain
+
+import (
+	"bytes"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/common"
+	common2 "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// RollbackTask asks the extended store to remove every row indexed for a
+// block that has been detached from the main chain.
+type RollbackTask struct {
+	Block *Block
+}
+
+// rollbackTxHistory removes the rows written for the given block and moves
+// the checkpoint back to its parent. Blocks above it that are still indexed
+// are removed as well, so the index never keeps a gap.
+func (c ChainStoreExtend) rollbackTxHistory(block *Block) error {
+	return c.rollbackToHeight(block.Height)
+}
+
+// rollbackToHeight removes the rows of every indexed block from the tip down
+// to the given height, leaving the checkpoint below it.
+func (c ChainStoreExtend) rollbackToHeight(height uint32) error {
+	indexed, ok := c.getIndexedHeight()
+	if !ok || height > indexed {
+		log.Debugf("block at height %d is not indexed, nothing to roll back", height)
+		return nil
+	}
+	if height < indexed {
+		log.Warnf("roll back transaction history from height %d down to %d", indexed, height)
+	}
+
+	c.NewBatch()
+	addresses := common.NewStringSet()
+	for h := indexed; ; h-- {
+		keys, err := c.getHeightIndex(h)
+		if err != nil {
+			log.Warnf("no height index at height %d: %s", h, err)
+		}
+		for _, key := range keys {
+			if key[0] == byte(DataBalancePrefix) {
+				if address, err := common2.ReadVarString(bytes.NewReader(key[1:])); err == nil {
+					addresses.Add(address)
+				}
+			}
+			c.BatchDelete(key)
+		}
+		c.BatchDelete(heightIndexKey(h))
+		if h == height {
+			break
+		}
+	}
+	if err := c.rollbackRichList(addresses, height-1, height == 0); err != nil {
+		return err
+	}
+	c.batchRollback(height)
+	if height == 0 {
+		c.BatchDelete([]byte{byte(DataIndexedHeightPrefix)})
+	} else {
+		c.persistIndexedHeight(height - 1)
+	}
+	return c.BatchCommit()
+}
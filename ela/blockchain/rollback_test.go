@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"testing"
+
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_RollbackFork(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+
+	minerA, addrA := testAddress(1)
+	minerB, addrB := testAddress(2)
+	_, addrC := testAddress(3)
+	_, addrD := testAddress(4)
+	minerE, addrE := testAddress(5)
+	programC, _ := testAddress(3)
+	programD, _ := testAddress(4)
+
+	coinbase0 := testCoinbase(0, testOutput(minerA, 100))
+	pay1 := testTransfer([]*types2.Input{testInput(coinbase0, 0)},
+		testOutput(programC, 60), testOutput(minerA, 39))
+	pay2a := testTransfer([]*types2.Input{testInput(pay1, 0)},
+		testOutput(programD, 59))
+
+	shared := []*types2.Block{
+		testBlock(0, coinbase0),
+		testBlock(1, testCoinbase(1, testOutput(minerB, 100)), pay1),
+	}
+	forkA := []*types2.Block{
+		testBlock(2, testCoinbase(2, testOutput(minerB, 100)), pay2a),
+		testBlock(3, testCoinbase(3, testOutput(minerB, 100))),
+	}
+	forkB := []*types2.Block{
+		testBlock(2, testCoinbase(2, testOutput(minerE, 100))),
+		testBlock(3, testCoinbase(3, testOutput(minerE, 100))),
+		testBlock(4, testCoinbase(4, testOutput(minerE, 100))),
+	}
+
+	persist := func(b *types2.Block) {
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, b := range append(shared, forkA...) {
+		persist(b)
+	}
+	if len(c.GetTxHistory(addrD)) != 1 {
+		t.Fatalf("expect one history row for %s before the fork", addrD)
+	}
+
+	// detach fork A from the tip down, as the chain reorganization does
+	for range forkA {
+		if err := c.rollbackTxHistory(chain.disconnect()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if height, ok := c.getIndexedHeight(); !ok || height != 1 {
+		t.Fatalf("expect indexed height 1 after rollback, got %d", height)
+	}
+	for _, b := range forkB {
+		persist(b)
+	}
+
+	if txhs := c.GetTxHistory(addrD); len(txhs) != 0 {
+		t.Fatalf("orphaned rows left for %s: %v", addrD, txhs)
+	}
+	txhs := c.GetTxHistory(addrC)
+	if len(txhs) != 1 || txhs[0].Height != 1 || txhs[0].Type != INCOME {
+		t.Fatalf("unexpected history for %s: %v", addrC, txhs)
+	}
+	for _, txh := range c.GetTxHistory(addrB) {
+		if txh.Height > 1 {
+			t.Fatalf("orphaned coinbase row left for %s: %v", addrB, txh)
+		}
+	}
+	if txhs := c.GetTxHistory(addrE); len(txhs) != 3 {
+		t.Fatalf("expect 3 rows for %s, got %v", addrE, txhs)
+	}
+	if len(c.GetTxHistory(addrA)) != 2 {
+		t.Fatalf("expect 2 rows for %s", addrA)
+	}
+	if height, ok := c.getIndexedHeight(); !ok || height != 4 {
+		t.Fatalf("expect indexed height 4, got %d", height)
+	}
+}
+
+func Test_RollbackNotIndexed(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	minerA, _ := testAddress(1)
+	b0 := testBlock(0, testCoinbase(0, testOutput(minerA, 100)))
+	chain.connect(b0)
+	if err := c.persistTxHistory(b0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.rollbackTxHistory(testBlock(1, testCoinbase(1, testOutput(minerA, 100)))); err != nil {
+		t.Fatal(err)
+	}
+	if height, ok := c.getIndexedHeight(); !ok || height != 0 {
+		t.Fatalf("rollback of an unindexed block must keep the checkpoint, got %d", height)
+	}
+	if err := c.rollbackTxHistory(chain.disconnect()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.getIndexedHeight(); ok {
+		t.Fatal("rollback of genesis must clear the checkpoint")
+	}
+}
@@ -0,0 +1,217 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+)
+
+const (
+	// schemaVersionLegacy is the layout of stores written before the schema
+	// version record existed: DataTxHistoryPrefix + address + height.
+	schemaVersionLegacy uint32 = 1
+	// schemaVersionTxid keys rows by
+	// DataTxHistoryPrefix + address + height + txid + role.
+	schemaVersionTxid uint32 = 2
+	// schemaVersionBalance adds the balance snapshots of every address.
+	schemaVersionBalance uint32 = 3
+	// schemaVersionSummary adds the summary counters of every address.
+	schemaVersionSummary uint32 = 4
+	// schemaVersionRichList adds the rich list.
+	schemaVersionRichList uint32 = 5
+	// schemaVersionSpentOutput adds the spent output index.
+	schemaVersionSpentOutput uint32 = 6
+	// schemaVersionRichListBuckets adds the holder counts of the rich list
+	// buckets.
+	schemaVersionRichListBuckets uint32 = 7
+	// SchemaVersion is the layout written by this node, which counts the fee
+	// of a transaction in the summary of one address only.
+	SchemaVersion uint32 = 8
+
+	// legacyHeightLength is the length of the height suffix of a legacy key.
+	legacyHeightLength = 8
+	// migrateBatchSize is the number of rows rewritten per batch commit.
+	migrateBatchSize = 10000
+)
+
+// checkSchemaVersion makes sure the ext store can be read by this node,
+// migrating a store written with an older key layout.
+func (c ChainStoreExtend) checkSchemaVersion() error {
+	version, ok := c.getSchemaVersion()
+	if !ok {
+		version = schemaVersionLegacy
+		if !c.hasTxHistory() {
+			version = SchemaVersion
+		}
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("ext store schema version %d is newer than the supported version %d",
+			version, SchemaVersion)
+	}
+	stored := version
+	if version == schemaVersionLegacy {
+		log.Info("migrate transaction history to schema version", schemaVersionTxid)
+		if err := c.migrateLegacyTxHistory(); err != nil {
+			return err
+		}
+		version = schemaVersionTxid
+	}
+	if version == schemaVersionTxid {
+		log.Info("migrate transaction history to schema version", schemaVersionBalance)
+		if err := c.migrateAddressSnapshots(DataBalancePrefix, newBalanceSnapshot); err != nil {
+			return err
+		}
+		version = schemaVersionBalance
+	}
+	if version == schemaVersionBalance {
+		log.Info("migrate transaction history to schema version", schemaVersionSummary)
+		if err := c.migrateAddressSnapshots(DataAddressSummaryPrefix, newAddressSummary); err != nil {
+			return err
+		}
+		version = schemaVersionSummary
+	}
+	if version == schemaVersionSummary {
+		log.Info("migrate transaction history to schema version", schemaVersionRichList)
+		if err := c.migrateRichList(); err != nil {
+			return err
+		}
+		version = schemaVersionRichList
+	}
+	if version == schemaVersionRichList {
+		log.Info("migrate transaction history to schema version", schemaVersionSpentOutput)
+		if err := c.migrateSpentOutputs(); err != nil {
+			return err
+		}
+		version = schemaVersionSpentOutput
+	}
+	if version == schemaVersionSpentOutput {
+		log.Info("migrate transaction history to schema version", schemaVersionRichListBuckets)
+		if err := c.migrateRichListBuckets(); err != nil {
+			return err
+		}
+		version = schemaVersionRichListBuckets
+	}
+	if version == schemaVersionRichListBuckets {
+		log.Info("migrate transaction history to schema version", SchemaVersion)
+		if err := c.migrateAddressSnapshots(DataAddressSummaryPrefix, newAddressSummary); err != nil {
+			return err
+		}
+		version = SchemaVersion
+	}
+	if !ok || stored != SchemaVersion {
+		return c.persistSchemaVersion(SchemaVersion)
+	}
+	return nil
+}
+
+// key: DataSchemaVersionPrefix
+// value: version of the key layout used by the ext store
+func (c ChainStoreExtend) persistSchemaVersion(version uint32) error {
+	value := new(bytes.Buffer)
+	common.WriteUint32(value, version)
+	return c.Put([]byte{byte(DataSchemaVersionPrefix)}, value.Bytes())
+}
+
+func (c ChainStoreExtend) getSchemaVersion() (uint32, bool) {
+	data, err := c.Get([]byte{byte(DataSchemaVersionPrefix)})
+	if err != nil {
+		return 0, false
+	}
+	version, err := common.ReadUint32(bytes.NewReader(data))
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
+
+func (c ChainStoreExtend) hasTxHistory() bool {
+	iter := c.NewIterator([]byte{byte(DataTxHistoryPrefix)})
+	defer iter.Release()
+	return iter.Next()
+}
+
+// migrateLegacyTxHistory rewrites every legacy row under the collision-free
+// key and rebuilds the height index from the rewritten keys. Rows that the
+// legacy layout already overwrote cannot be recovered this way, only by
+// rebuilding the index with -reindex.
+func (c ChainStoreExtend) migrateLegacyTxHistory() error {
+	if err := c.deletePrefix(DataHeightIndexPrefix); err != nil {
+		return err
+	}
+
+	iter := c.NewIterator([]byte{byte(DataTxHistoryPrefix)})
+	defer iter.Release()
+	count := 0
+	heights := make(map[uint32][][]byte)
+	c.NewBatch()
+	for iter.Next() {
+		if !isLegacyTxHistoryKey(iter.Key()) {
+			continue
+		}
+		var txh types.TransactionHistory
+		if err := txh.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+			return err
+		}
+		key, err := txHistoryKey(txh)
+		if err != nil {
+			return err
+		}
+		oldKey := make([]byte, len(iter.Key()))
+		copy(oldKey, iter.Key())
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
+		c.BatchDelete(oldKey)
+		c.BatchPut(key, value)
+		heights[uint32(txh.Height)] = append(heights[uint32(txh.Height)], key)
+		count++
+		if count%migrateBatchSize == 0 {
+			if err := c.commitMigratedHeights(heights); err != nil {
+				return err
+			}
+			heights = make(map[uint32][][]byte)
+			c.NewBatch()
+		}
+	}
+	if err := c.commitMigratedHeights(heights); err != nil {
+		return err
+	}
+	log.Infof("%d transaction history rows migrated, run with -reindex to recover rows lost to key collisions", count)
+	return nil
+}
+
+// commitMigratedHeights merges the keys rewritten in the current batch into
+// the height index entries committed by earlier batches, then commits. A key
+// already listed, rewritten by a migration building its entries again, is
+// listed once.
+func (c ChainStoreExtend) commitMigratedHeights(heights map[uint32][][]byte) error {
+	for height, keys := range heights {
+		committed, err := c.getHeightIndex(height)
+		if err == nil {
+			listed := make(map[string]struct{}, len(committed))
+			for _, key := range committed {
+				listed[string(key)] = struct{}{}
+			}
+			for _, key := range keys {
+				if _, ok := listed[string(key)]; !ok {
+					committed = append(committed, key)
+				}
+			}
+			keys = committed
+		}
+		if err := c.persistHeightIndex(height, keys); err != nil {
+			return err
+		}
+	}
+	return c.BatchCommit()
+}
+
+func isLegacyTxHistoryKey(key []byte) bool {
+	r := bytes.NewReader(key[1:])
+	if _, err := common.ReadVarString(r); err != nil {
+		return false
+	}
+	return r.Len() == legacyHeightLength
+}
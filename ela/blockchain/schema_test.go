@@ -0,0 +1,178 @@
+package blockchain
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	. "github.com/elastos/Elastos.ELA/blockchain"
+	"github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// legacyTxHistoryKey builds a key in the layout written before the schema
+// version record existed.
+func legacyTxHistoryKey(t *testing.T, address string, height uint64) []byte {
+	key := new(bytes.Buffer)
+	key.WriteByte(byte(DataTxHistoryPrefix))
+	if err := common.WriteVarString(key, address); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.WriteUint64(key, height); err != nil {
+		t.Fatal(err)
+	}
+	return key.Bytes()
+}
+
+func Test_MigrateLegacyTxHistory(t *testing.T) {
+	st := newMemStore(t)
+	c := newChainStoreEx(newTestChainStore(), st)
+	_, addr := testAddress(1)
+	rows := []types.TransactionHistory{
+		{Address: addr, Txid: "7e6f5a46740a84998e070d0c6560ce2efa92979c84bb8fb2cae3caaab9c808d5", Type: INCOME, Value: 10, Height: 3},
+		{Address: addr, Txid: "d508c8b9aacae3cab28fbb849c9792fa2ece60650c0d078e99840a74465a6f7e", Type: SPEND, Value: 4, Height: 7},
+	}
+	for _, txh := range rows {
+		value := new(bytes.Buffer)
+		if err := txh.Serialize(value); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Put(legacyTxHistoryKey(t, txh.Address, txh.Height), value.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.checkSchemaVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if version, ok := c.getSchemaVersion(); !ok || version != SchemaVersion {
+		t.Fatalf("expect schema version %d, got %d", SchemaVersion, version)
+	}
+	txhs := c.GetTxHistory(addr)
+	if len(txhs) != 2 || txhs[0].Height != 3 || txhs[1].Height != 7 {
+		t.Fatalf("unexpected history after migration: %v", txhs)
+	}
+	iter := st.NewIterator([]byte{byte(DataTxHistoryPrefix)})
+	for iter.Next() {
+		if isLegacyTxHistoryKey(iter.Key()) {
+			t.Fatalf("legacy key left after migration: %x", iter.Key())
+		}
+	}
+	iter.Release()
+	// every height lists the migrated row and the snapshots built from it
+	for _, txh := range rows {
+		keys, err := c.getHeightIndex(uint32(txh.Height))
+		if err != nil || len(keys) != 3 {
+			t.Fatalf("height index at %d not rebuilt: %v", txh.Height, err)
+		}
+	}
+
+	// a second open finds the version record and leaves the store alone
+	if err := c.checkSchemaVersion(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_CheckSchemaVersionTooNew(t *testing.T) {
+	c := newChainStoreEx(newTestChainStore(), newMemStore(t))
+	if err := c.persistSchemaVersion(SchemaVersion + 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.checkSchemaVersion(); err == nil {
+		t.Fatal("expect an error opening a store written by a newer node")
+	}
+}
+
+func Test_TxHistoryKeyNoCollision(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	miner, _ := testAddress(1)
+	payee, payeeAddr := testAddress(2)
+
+	coinbase0 := testCoinbase(0, testOutput(miner, 100), testOutput(miner, 100))
+	b0 := testBlock(0, coinbase0)
+	b1 := testBlock(1, testCoinbase(1, testOutput(miner, 100)),
+		testTransfer([]*types2.Input{testInput(coinbase0, 0)}, testOutput(payee, 99)),
+		testTransfer([]*types2.Input{testInput(coinbase0, 1)}, testOutput(payee, 98)))
+	for _, b := range []*types2.Block{b0, b1} {
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	txhs := c.GetTxHistory(payeeAddr)
+	if len(txhs) != 2 {
+		t.Fatalf("expect both payments in block 1 to be kept, got %v", txhs)
+	}
+}
+
+func Test_MigrateAddressSnapshots(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 300), testOutput(alice, 690))
+	for h, tx := range []*types2.Transaction{coinbase, pay} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	balances := make(map[string][]BalanceSnapshot)
+	summaries := make(map[string]*AddressSummary)
+	for _, addr := range []string{aliceAddr, bobAddr} {
+		balances[addr], _ = c.GetBalanceSeries(addr, 0, 1, 0)
+		summaries[addr], _, _ = c.GetAddressSummary(addr)
+	}
+
+	// drop the snapshots, the spent outputs and their height index entries
+	// to get a store written with schema version 2
+	for _, prefix := range []DataEntryPrefix{DataBalancePrefix, DataAddressSummaryPrefix,
+		DataSpentOutputPrefix} {
+		if err := c.deletePrefix(prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for h := uint32(0); h <= 1; h++ {
+		keys, _ := c.getHeightIndex(h)
+		var rows [][]byte
+		for _, key := range keys {
+			if key[0] == byte(DataTxHistoryPrefix) {
+				rows = append(rows, key)
+			}
+		}
+		c.NewBatch()
+		c.persistHeightIndex(h, rows)
+		c.BatchCommit()
+	}
+	if err := c.persistSchemaVersion(schemaVersionTxid); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.checkSchemaVersion(); err != nil {
+		t.Fatal(err)
+	}
+	for addr, series := range balances {
+		got, err := c.GetBalanceSeries(addr, 0, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, series) || len(got) == 0 {
+			t.Errorf("%s: expect series %+v, got %+v", addr, series, got)
+		}
+		summary, _, err := c.GetAddressSummary(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(summary, summaries[addr]) {
+			t.Errorf("%s: expect summary %+v, got %+v", addr, summaries[addr], summary)
+		}
+	}
+	keys, err := c.getHeightIndex(1)
+	if err != nil || len(keys) != 7 {
+		t.Errorf("expect the height index to list rows, snapshots and the spent output, got %d keys: %v", len(keys), err)
+	}
+}
@@ -0,0 +1,127 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	common2 "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// SpentOutput is the input of a transaction that spends an output.
+type SpentOutput struct {
+	Txid   common2.Uint256
+	Index  uint16
+	Height uint32
+}
+
+// persistSpentOutputs records the input spending every output spent in a
+// block and returns the keys it wrote.
+//
+// key: DataSpentOutputPrefix + txid + index
+// value: spending txid + input index + height
+func (c ChainStoreExtend) persistSpentOutputs(block *Block) ([][]byte, error) {
+	var keys [][]byte
+	for _, tx := range block.Transactions {
+		if tx.TxType == CoinBase {
+			continue
+		}
+		hash := tx.Hash()
+		for i, input := range tx.Inputs {
+			key := spentOutputKey(input.Previous.TxID, input.Previous.Index)
+			value := new(bytes.Buffer)
+			if err := hash.Serialize(value); err != nil {
+				return nil, err
+			}
+			if err := common2.WriteUint16(value, uint16(i)); err != nil {
+				return nil, err
+			}
+			if err := common2.WriteUint32(value, block.Height); err != nil {
+				return nil, err
+			}
+			c.BatchPut(key, value.Bytes())
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// GetSpentBy returns the input spending an output, and whether the output
+// is spent by an indexed block. A failing read of the store is returned,
+// it does not mean the output is unspent.
+func (c ChainStoreExtend) GetSpentBy(txid common2.Uint256, index uint16) (*SpentOutput, bool, error) {
+	data, err := c.Get(spentOutputKey(txid, index))
+	if err == leveldb.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	r := bytes.NewReader(data)
+	spent := new(SpentOutput)
+	if err := spent.Txid.Deserialize(r); err != nil {
+		return nil, false, err
+	}
+	if spent.Index, err = common2.ReadUint16(r); err != nil {
+		return nil, false, err
+	}
+	if spent.Height, err = common2.ReadUint32(r); err != nil {
+		return nil, false, err
+	}
+	return spent, true, nil
+}
+
+func spentOutputKey(txid common2.Uint256, index uint16) []byte {
+	key := make([]byte, 1+len(txid)+2)
+	key[0] = byte(DataSpentOutputPrefix)
+	copy(key[1:], txid[:])
+	binary.BigEndian.PutUint16(key[1+len(txid):], index)
+	return key
+}
+
+// migrateSpentOutputs builds the spent output index of the blocks indexed
+// before it existed, reading them back from the chain store.
+func (c ChainStoreExtend) migrateSpentOutputs() error {
+	indexed, ok := c.getIndexedHeight()
+	if !ok {
+		return nil
+	}
+	count := 0
+	heights := make(map[uint32][][]byte)
+	c.NewBatch()
+	for height := uint32(0); height <= indexed; height++ {
+		hash, err := c.GetBlockHash(height)
+		if err != nil {
+			return err
+		}
+		block, err := c.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+		keys, err := c.persistSpentOutputs(block)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			heights[height] = keys
+			count += len(keys)
+		}
+		if len(heights) == migrateBatchSize {
+			if err := c.commitMigratedHeights(heights); err != nil {
+				return err
+			}
+			heights = make(map[uint32][][]byte)
+			c.NewBatch()
+		}
+		if height%reindexLogInterval == 0 {
+			log.Infof("spent outputs indexed up to height %d", height)
+		}
+	}
+	if err := c.commitMigratedHeights(heights); err != nil {
+		return err
+	}
+	log.Infof("%d spent outputs indexed", count)
+	return nil
+}
@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA/common"
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_SpentOutputs(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, _ := testAddress(1)
+	bob, _ := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 100), testOutput(alice, 200))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 1)}, testOutput(bob, 190))
+	blocks := []*types2.Block{testBlock(0, coinbase), testBlock(1, pay)}
+	for _, b := range blocks {
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := &SpentOutput{Txid: pay.Hash(), Index: 0, Height: 1}
+	spent, ok, err := c.GetSpentBy(coinbase.Hash(), 1)
+	if err != nil || !ok || !reflect.DeepEqual(spent, expect) {
+		t.Errorf("expect output 1 spent by %+v, got %+v %v %v", expect, spent, ok, err)
+	}
+	for _, index := range []uint16{0, 2} {
+		if _, ok, err := c.GetSpentBy(coinbase.Hash(), index); ok || err != nil {
+			t.Errorf("expect output %d unspent, got %v %v", index, ok, err)
+		}
+	}
+
+	// a detached block frees the outputs it spent
+	if err := c.rollbackTxHistory(chain.disconnect()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.GetSpentBy(coinbase.Hash(), 1); ok {
+		t.Error("expect output 1 unspent after the rollback")
+	}
+}
+
+func Test_SpentByStoreError(t *testing.T) {
+	store := newMemStore(t)
+	c := newChainStoreEx(newTestChainStore(), store)
+	store.Close()
+	if _, ok, err := c.GetSpentBy(common.Uint256{}, 0); ok || err == nil {
+		t.Errorf("expect the read error returned, got %v %v", ok, err)
+	}
+}
+
+func Test_MigrateSpentOutputs(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, _ := testAddress(1)
+	bob, _ := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 300), testOutput(alice, 690))
+	for h, tx := range []*types2.Transaction{coinbase, pay} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect, _, _ := c.GetSpentBy(coinbase.Hash(), 0)
+	keys, _ := c.getHeightIndex(1)
+
+	// drop the spent outputs and their height index entries to get a store
+	// written with schema version 5
+	if err := c.deletePrefix(DataSpentOutputPrefix); err != nil {
+		t.Fatal(err)
+	}
+	var rest [][]byte
+	for _, key := range keys {
+		if key[0] != byte(DataSpentOutputPrefix) {
+			rest = append(rest, key)
+		}
+	}
+	c.NewBatch()
+	c.persistHeightIndex(1, rest)
+	c.BatchCommit()
+	if err := c.persistSchemaVersion(schemaVersionRichList); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.checkSchemaVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if spent, ok, err := c.GetSpentBy(coinbase.Hash(), 0); err != nil || !ok || !reflect.DeepEqual(spent, expect) {
+		t.Errorf("expect migrated spent output %+v, got %+v %v %v", expect, spent, ok, err)
+	}
+	if migrated, err := c.getHeightIndex(1); err != nil || len(migrated) != len(keys) {
+		t.Errorf("expect %d height index keys, got %d: %v", len(keys), len(migrated), err)
+	}
+}
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"io"
+	"math"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	common2 "github.com/elastos/Elastos.ELA/common"
+)
+
+// AddressSummary holds the counters of an address over its whole history.
+// Fees sums the fees the address paid. The fee of a transaction is counted
+// once, for the address of its first input, since every spend row of the
+// transaction carries the whole fee. When that address receives more than
+// it spends in the transaction, no address is charged the fee.
+type AddressSummary struct {
+	Received    uint64
+	Sent        uint64
+	Fees        uint64
+	TxCount     uint64
+	FirstHeight uint32
+	FirstTime   uint64
+	LastHeight  uint32
+	LastTime    uint64
+}
+
+func newAddressSummary() addressCounter {
+	return new(AddressSummary)
+}
+
+func (s *AddressSummary) add(txh *types.TransactionHistory) {
+	if s.TxCount == 0 {
+		s.FirstHeight = uint32(txh.Height)
+		s.FirstTime = txh.CreateTime
+	}
+	s.TxCount++
+	s.LastHeight = uint32(txh.Height)
+	s.LastTime = txh.CreateTime
+	if txh.Type == SPEND {
+		s.Sent += txh.Value
+		if len(txh.Inputs) > 0 && txh.Inputs[0] == txh.Address {
+			s.Fees += txh.Fee
+		}
+	} else {
+		s.Received += txh.Value
+	}
+}
+
+func (s *AddressSummary) Serialize(w io.Writer) error {
+	for _, v := range []uint64{s.Received, s.Sent, s.Fees, s.TxCount,
+		uint64(s.FirstHeight), s.FirstTime, uint64(s.LastHeight), s.LastTime} {
+		if err := common2.WriteUint64(w, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AddressSummary) Deserialize(r io.Reader) error {
+	var heights [2]uint64
+	for _, v := range []*uint64{&s.Received, &s.Sent, &s.Fees, &s.TxCount,
+		&heights[0], &s.FirstTime, &heights[1], &s.LastTime} {
+		var err error
+		if *v, err = common2.ReadUint64(r); err != nil {
+			return err
+		}
+	}
+	s.FirstHeight = uint32(heights[0])
+	s.LastHeight = uint32(heights[1])
+	return nil
+}
+
+// GetAddressSummary returns the counters of an address. It reports false
+// when the address has no history.
+//
+// key: DataAddressSummaryPrefix + address + height
+// value: summary after the block at that height
+func (c ChainStoreExtend) GetAddressSummary(address string) (*AddressSummary, bool, error) {
+	prefix, err := addressSnapshotPrefix(DataAddressSummaryPrefix, address)
+	if err != nil {
+		return nil, false, err
+	}
+	summary := new(AddressSummary)
+	ok, err := c.getAddressSnapshot(prefix, math.MaxUint32, summary)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return summary, true, nil
+}
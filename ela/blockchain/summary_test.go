@@ -0,0 +1,115 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_AddressSummary(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 300), testOutput(alice, 690))
+	payBack := testTransfer([]*types2.Input{testInput(pay, 0)}, testOutput(alice, 295))
+	var blocks []*types2.Block
+	for h, tx := range []*types2.Transaction{coinbase, pay, payBack} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	tests := []struct {
+		addr   string
+		expect AddressSummary
+	}{
+		{aliceAddr, AddressSummary{
+			Received: 1295, Sent: 310, Fees: 10, TxCount: 3,
+			FirstHeight: 0, FirstTime: uint64(blocks[0].Timestamp),
+			LastHeight: 2, LastTime: uint64(blocks[2].Timestamp),
+		}},
+		{bobAddr, AddressSummary{
+			Received: 300, Sent: 300, Fees: 5, TxCount: 2,
+			FirstHeight: 1, FirstTime: uint64(blocks[1].Timestamp),
+			LastHeight: 2, LastTime: uint64(blocks[2].Timestamp),
+		}},
+	}
+	for _, test := range tests {
+		summary, ok, err := c.GetAddressSummary(test.addr)
+		if err != nil || !ok {
+			t.Fatalf("%s: no summary: %v", test.addr, err)
+		}
+		if *summary != test.expect {
+			t.Errorf("%s: expect %+v, got %+v", test.addr, test.expect, *summary)
+		}
+	}
+	if _, ok, _ := c.GetAddressSummary("unknown"); ok {
+		t.Error("expect no summary for an address without history")
+	}
+
+	if err := c.rollbackTxHistory(blocks[2]); err != nil {
+		t.Fatal(err)
+	}
+	summary, _, _ := c.GetAddressSummary(bobAddr)
+	if summary.TxCount != 1 || summary.Sent != 0 || summary.LastHeight != 1 {
+		t.Errorf("expect the summary to be rolled back, got %+v", summary)
+	}
+}
+
+func Test_AddressSummarySharedFee(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	carol, carolAddr := testAddress(3)
+
+	coinbase := testCoinbase(0, testOutput(alice, 1000), testOutput(bob, 500))
+	merge := testTransfer([]*types2.Input{testInput(coinbase, 0), testInput(coinbase, 1)}, testOutput(carol, 1490))
+	for h, tx := range []*types2.Transaction{coinbase, merge} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fees := map[string]uint64{aliceAddr: 10, bobAddr: 0, carolAddr: 0}
+	check := func(when string) {
+		for addr, expect := range fees {
+			summary, _, err := c.GetAddressSummary(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Fees != expect {
+				t.Errorf("%s: expect %s to pay %d, got %d", when, addr, expect, summary.Fees)
+			}
+		}
+	}
+	check("indexed")
+
+	// a summary counting the fee for every spending address is counted again
+	bobPrefix, _ := addressSnapshotPrefix(DataAddressSummaryPrefix, bobAddr)
+	stale := AddressSummary{Received: 500, Sent: 500, Fees: 10, TxCount: 2, LastHeight: 1}
+	value := new(bytes.Buffer)
+	stale.Serialize(value)
+	if err := c.Put(heightKey(bobPrefix, 1), value.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := c.getHeightIndex(1)
+	if err := c.persistSchemaVersion(schemaVersionRichListBuckets); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.checkSchemaVersion(); err != nil {
+		t.Fatal(err)
+	}
+	check("migrated")
+	if after, _ := c.getHeightIndex(1); len(after) != len(before) {
+		t.Errorf("expect the height index to list %d keys, got %d", len(before), len(after))
+	}
+}
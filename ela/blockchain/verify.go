@@ -0,0 +1,421 @@
+package blockchain
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	common2 "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+)
+
+const (
+	// verifyWaitTimeout is how long the balances found mismatched wait for
+	// the index to reach the chain tip without it making progress.
+	verifyWaitTimeout  = time.Minute
+	verifyWaitInterval = time.Second
+)
+
+var errVerifyStopped = errors.New("verification stopped")
+
+// VerifyTask asks for the index to be checked against the main chain store.
+// With Repair set the blocks from the lowest inconsistent height up are
+// indexed again.
+type VerifyTask struct {
+	Repair bool
+}
+
+// repairTask hands the repair of a verified index to the loop, which alone
+// writes the index.
+type repairTask struct {
+	report *VerifyReport
+}
+
+// HeightRange is an inclusive range of block heights.
+type HeightRange struct {
+	From uint32 `json:"from"`
+	To   uint32 `json:"to"`
+}
+
+// BalanceMismatch is an address whose balance summed from its history rows
+// differs from the value of its unspent outputs. FirstHeight is the height
+// of its first row, from where its history is indexed again on repair.
+type BalanceMismatch struct {
+	Address     string `json:"address"`
+	Indexed     int64  `json:"indexed"`
+	Chain       uint64 `json:"chain"`
+	FirstHeight uint32 `json:"firstheight"`
+}
+
+// VerifyReport is the outcome of a verification. MissingRows lists the
+// blocks below the checkpoint whose rows or height index entry are not all
+// stored.
+type VerifyReport struct {
+	Repair            bool              `json:"repair"`
+	Started           int64             `json:"started"`
+	Finished          int64             `json:"finished"`
+	IndexedHeight     uint32            `json:"indexedheight"`
+	ChainHeight       uint32            `json:"chainheight"`
+	Blocks            uint32            `json:"blocks"`
+	Addresses         uint64            `json:"addresses"`
+	MissingRows       []HeightRange     `json:"missingrows"`
+	BalanceMismatches []BalanceMismatch `json:"balancemismatches"`
+	Repaired          bool              `json:"repaired"`
+	RepairFrom        uint32            `json:"repairfrom"`
+	Error             string            `json:"error,omitempty"`
+}
+
+// Consistent reports whether the verification found nothing to repair.
+func (r *VerifyReport) Consistent() bool {
+	return r.Error == "" && len(r.MissingRows) == 0 && len(r.BalanceMismatches) == 0
+}
+
+// lowestInconsistentHeight returns the height the index has to be rebuilt
+// from to repair every inconsistency found.
+func (r *VerifyReport) lowestInconsistentHeight() uint32 {
+	lowest := r.IndexedHeight
+	for _, missing := range r.MissingRows {
+		if missing.From < lowest {
+			lowest = missing.From
+		}
+	}
+	for _, mismatch := range r.BalanceMismatches {
+		if mismatch.FirstHeight < lowest {
+			lowest = mismatch.FirstHeight
+		}
+	}
+	return lowest
+}
+
+// addMissing records the rows of a height missing, extending the last range
+// when it ends right below.
+func (r *VerifyReport) addMissing(height uint32) {
+	n := len(r.MissingRows)
+	if n > 0 && r.MissingRows[n-1].To == height-1 {
+		r.MissingRows[n-1].To = height
+	} else {
+		r.MissingRows = append(r.MissingRows, HeightRange{From: height, To: height})
+	}
+}
+
+// indexVerifier keeps the last report, shared by the copies of the store.
+// stop is closed when the store closes.
+type indexVerifier struct {
+	sync.RWMutex
+	running bool
+	last    *VerifyReport
+	stop    chan struct{}
+}
+
+func newIndexVerifier() *indexVerifier {
+	return &indexVerifier{stop: make(chan struct{})}
+}
+
+// StartVerify starts a verification, optionally repairing what it finds.
+// It returns false if a verification is already running.
+func (c ChainStoreExtend) StartVerify(repair bool) bool {
+	c.verifier.Lock()
+	if c.verifier.running {
+		c.verifier.Unlock()
+		return false
+	}
+	c.verifier.running = true
+	c.verifier.Unlock()
+	go c.verify(&VerifyTask{Repair: repair})
+	return true
+}
+
+// GetVerifyReport returns the report of the last verification, nil if none
+// finished yet, and whether one is running.
+func (c ChainStoreExtend) GetVerifyReport() (*VerifyReport, bool) {
+	c.verifier.RLock()
+	defer c.verifier.RUnlock()
+	return c.verifier.last, c.verifier.running
+}
+
+func (c ChainStoreExtend) finishVerify(report *VerifyReport) {
+	report.Finished = time.Now().Unix()
+	c.verifier.Lock()
+	c.verifier.running = false
+	c.verifier.last = report
+	c.verifier.Unlock()
+}
+
+// verify checks the index apart from the loop, which keeps indexing new
+// blocks meanwhile. Only the repair of what it found is handed to the loop.
+func (c ChainStoreExtend) verify(task *VerifyTask) {
+	report := &VerifyReport{Repair: task.Repair, Started: time.Now().Unix()}
+	if err := c.check(report); err != nil {
+		report.Error = err.Error()
+		c.finishVerify(report)
+		return
+	}
+	for _, missing := range report.MissingRows {
+		log.Warnf("transaction history missing from height %d to %d", missing.From, missing.To)
+	}
+	for _, mismatch := range report.BalanceMismatches {
+		log.Warnf("balance of %s is %d in the index and %d in the chain", mismatch.Address,
+			mismatch.Indexed, mismatch.Chain)
+	}
+	if report.Consistent() {
+		log.Infof("transaction history index verified: %d blocks, %d addresses", report.Blocks,
+			report.Addresses)
+	}
+	if report.Consistent() || !task.Repair {
+		c.finishVerify(report)
+		return
+	}
+	c.taskChEx <- &repairTask{report}
+}
+
+// check fills a report with the inconsistencies of the index up to the
+// checkpoint. Those found while the loop changed the index are checked
+// again, so blocks indexed or rolled back meanwhile are not reported.
+func (c ChainStoreExtend) check(report *VerifyReport) error {
+	indexed, ok := c.getIndexedHeight()
+	if !ok {
+		return errors.New("nothing indexed")
+	}
+	report.IndexedHeight = indexed
+	report.ChainHeight = c.GetHeight()
+	log.Infof("verify transaction history index up to height %d", indexed)
+
+	if err := c.verifyBlocks(report); err != nil {
+		return err
+	}
+	if err := c.verifyBalances(report); err != nil {
+		return err
+	}
+	if len(report.MissingRows) > 0 {
+		if err := c.recheckBlocks(report); err != nil {
+			return err
+		}
+	}
+	if len(report.BalanceMismatches) > 0 {
+		return c.recheckBalances(report)
+	}
+	return nil
+}
+
+// verifyBlocks checks that every row of the blocks up to the checkpoint and
+// their height index entries are stored.
+func (c ChainStoreExtend) verifyBlocks(report *VerifyReport) error {
+	for height := uint32(0); height <= report.IndexedHeight; height++ {
+		select {
+		case <-c.verifier.stop:
+			log.Infof("transaction history verification stopped at height %d", height-1)
+			return errVerifyStopped
+		default:
+		}
+		complete, err := c.verifyBlock(height)
+		if err != nil {
+			return err
+		}
+		report.Blocks++
+		if !complete {
+			report.addMissing(height)
+		}
+		if height%reindexLogInterval == 0 {
+			log.Infof("transaction history verified to height %d", height)
+		}
+	}
+	return nil
+}
+
+// recheckBlocks checks the blocks found incomplete again, dropping those
+// whose rows were written meanwhile.
+func (c ChainStoreExtend) recheckBlocks(report *VerifyReport) error {
+	missingRows := report.MissingRows
+	report.MissingRows = nil
+	for _, missing := range missingRows {
+		for height := missing.From; height <= missing.To; height++ {
+			complete, err := c.verifyBlock(height)
+			if err != nil {
+				return err
+			}
+			if !complete {
+				report.addMissing(height)
+			}
+		}
+	}
+	return nil
+}
+
+func (c ChainStoreExtend) verifyBlock(height uint32) (bool, error) {
+	hash, err := c.GetBlockHash(height)
+	if err != nil {
+		return false, err
+	}
+	block, err := c.GetBlock(hash)
+	if err != nil {
+		return false, err
+	}
+	txhs, err := c.blockTxHistory(block, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(txhs) == 0 {
+		return true, nil
+	}
+	if _, err := c.getHeightIndex(height); err != nil {
+		return false, nil
+	}
+	for _, txh := range txhs {
+		key, err := txHistoryKey(txh)
+		if err != nil {
+			return false, err
+		}
+		if _, err := c.Get(key); err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// verifyBalances sums the history rows of every address and compares the
+// result with the value of its unspent outputs in the chain store.
+func (c ChainStoreExtend) verifyBalances(report *VerifyReport) error {
+	iter := c.NewIterator([]byte{byte(DataTxHistoryPrefix)})
+	defer iter.Release()
+	var current *BalanceMismatch
+	check := func() error {
+		if current == nil {
+			return nil
+		}
+		programHash, err := common2.Uint168FromAddress(current.Address)
+		if err != nil {
+			// rows of the mining address and of burnt outputs
+			return nil
+		}
+		report.Addresses++
+		if current.Chain, err = c.unspentValue(*programHash); err != nil {
+			return err
+		}
+		if current.Indexed != int64(current.Chain) {
+			report.BalanceMismatches = append(report.BalanceMismatches, *current)
+		}
+		return nil
+	}
+	for iter.Next() {
+		txh, err := decodeTxHistory(iter.Value())
+		if err != nil {
+			return err
+		}
+		if current == nil || txh.Address != current.Address {
+			if err := check(); err != nil {
+				return err
+			}
+			current = &BalanceMismatch{Address: txh.Address, FirstHeight: uint32(txh.Height)}
+		}
+		current.Indexed += balanceDelta(txh)
+		if uint32(txh.Height) < current.FirstHeight {
+			current.FirstHeight = uint32(txh.Height)
+		}
+	}
+	return check()
+}
+
+// recheckBalances compares the balances found mismatched again once the
+// index reached the chain tip, as the unspent outputs move ahead of the rows
+// read while blocks are indexed. Those matching now are dropped. It gives
+// up when the index stops making progress.
+func (c ChainStoreExtend) recheckBalances(report *VerifyReport) error {
+	var progress uint32
+	waitSince := time.Now()
+	for {
+		height := c.GetHeight()
+		indexed, ok := c.getIndexedHeight()
+		if ok && indexed >= height {
+			mismatches, err := c.compareBalances(report.BalanceMismatches)
+			if err != nil {
+				return err
+			}
+			if c.GetHeight() == height {
+				report.ChainHeight = height
+				report.BalanceMismatches = mismatches
+				return nil
+			}
+		}
+		if indexed != progress {
+			progress = indexed
+			waitSince = time.Now()
+		} else if time.Since(waitSince) > verifyWaitTimeout {
+			return errors.New("the index does not reach the chain tip to compare balances")
+		}
+		select {
+		case <-time.After(verifyWaitInterval):
+		case <-c.verifier.stop:
+			return errVerifyStopped
+		}
+	}
+}
+
+// compareBalances returns the balances still mismatched.
+func (c ChainStoreExtend) compareBalances(balances []BalanceMismatch) ([]BalanceMismatch, error) {
+	var mismatches []BalanceMismatch
+	for _, mismatch := range balances {
+		mismatch.Indexed = 0
+		for _, txh := range c.GetTxHistory(mismatch.Address) {
+			mismatch.Indexed += balanceDelta(&txh)
+		}
+		programHash, err := common2.Uint168FromAddress(mismatch.Address)
+		if err != nil {
+			return nil, err
+		}
+		if mismatch.Chain, err = c.unspentValue(*programHash); err != nil {
+			return nil, err
+		}
+		if mismatch.Indexed != int64(mismatch.Chain) {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+	return mismatches, nil
+}
+
+func (c ChainStoreExtend) unspentValue(programHash common2.Uint168) (uint64, error) {
+	unspents, err := c.GetUnspentsFromProgramHash(programHash)
+	if err != nil {
+		return 0, err
+	}
+	var value common2.Fixed64
+	for _, utxos := range unspents {
+		for _, utxo := range utxos {
+			value += utxo.Value
+		}
+	}
+	return uint64(value), nil
+}
+
+// repair rolls the index back to the lowest inconsistent height and indexes
+// the blocks up to the chain tip again. Snapshots are cumulative, so every
+// block above that height is rebuilt as well. It runs on the loop, finishes
+// the verification and returns the close request if CloseEx was called
+// while blocks were being indexed.
+func (c ChainStoreExtend) repair(report *VerifyReport) chan bool {
+	defer c.finishVerify(report)
+	from := report.lowestInconsistentHeight()
+	log.Warnf("repair transaction history index from height %d", from)
+	hash, err := c.GetBlockHash(from)
+	if err != nil {
+		report.Error = err.Error()
+		return nil
+	}
+	block, err := c.GetBlock(hash)
+	if err != nil {
+		report.Error = err.Error()
+		return nil
+	}
+	if err := c.rollbackTxHistory(block); err != nil {
+		report.Error = err.Error()
+		return nil
+	}
+	report.RepairFrom = from
+	if closed, err := c.catchUp(c.GetHeight()); closed != nil || err != nil {
+		if err != nil {
+			report.Error = err.Error()
+		}
+		return closed
+	}
+	report.Repaired = true
+	return nil
+}
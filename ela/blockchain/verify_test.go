@@ -0,0 +1,124 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_VerifyIndex(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 300), testOutput(alice, 690))
+	blocks := []*types2.Block{
+		testBlock(0, coinbase),
+		testBlock(1, pay),
+		testBlock(2, testCoinbase(2, testOutput(bob, 50))),
+	}
+	for _, b := range blocks {
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.verify(&VerifyTask{})
+	report, running := c.GetVerifyReport()
+	if running || !report.Consistent() || report.Blocks != 3 || report.Addresses != 2 {
+		t.Fatalf("expect a consistent index, got %+v", report)
+	}
+
+	// lose the rows of bob at height 1
+	for _, txh := range c.GetTxHistory(bobAddr) {
+		if txh.Height == 1 {
+			key, _ := txHistoryKey(txh)
+			c.Delete(key)
+		}
+	}
+	c.verify(&VerifyTask{})
+	report, _ = c.GetVerifyReport()
+	expect := []BalanceMismatch{{Address: bobAddr, Indexed: 50, Chain: 350, FirstHeight: 2}}
+	if !reflect.DeepEqual(report.MissingRows, []HeightRange{{From: 1, To: 1}}) ||
+		!reflect.DeepEqual(report.BalanceMismatches, expect) || report.Repaired {
+		t.Fatalf("expect the missing rows and balance of %s, got %+v", bobAddr, report)
+	}
+
+	c.verify(&VerifyTask{Repair: true})
+	c.repair((<-c.taskChEx).(*repairTask).report)
+	report, _ = c.GetVerifyReport()
+	if !report.Repaired || report.RepairFrom != 1 {
+		t.Fatalf("expect a repair from height 1, got %+v", report)
+	}
+	c.verify(&VerifyTask{})
+	if report, _ = c.GetVerifyReport(); !report.Consistent() {
+		t.Errorf("expect a consistent index after the repair, got %+v", report)
+	}
+	if len(c.GetTxHistory(bobAddr)) != 2 || len(c.GetTxHistory(aliceAddr)) != 2 {
+		t.Errorf("expect the history to be rebuilt")
+	}
+}
+
+func Test_StartVerify(t *testing.T) {
+	c := newChainStoreEx(newTestChainStore(), newMemStore(t))
+	c.verifier.running = true
+	if c.StartVerify(true) {
+		t.Error("expect a verification to be refused while one is running")
+	}
+	c.verifier.running = false
+
+	if !c.StartVerify(false) {
+		t.Fatal("expect the verification to be started")
+	}
+	deadline := time.Now().Add(time.Second)
+	report, running := c.GetVerifyReport()
+	for running && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		report, running = c.GetVerifyReport()
+	}
+	if running || report == nil || report.Error == "" {
+		t.Errorf("expect a failed verification of an empty index, got %+v", report)
+	}
+}
+
+func Test_VerifyWhileIndexing(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, _ := testAddress(1)
+	bob, _ := testAddress(2)
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	chain.connect(testBlock(0, coinbase))
+	if err := c.persistTxHistory(chain.blocks[0]); err != nil {
+		t.Fatal(err)
+	}
+	// a block saved in the chain but not indexed yet moves the unspent
+	// outputs ahead of the rows
+	pay := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 300), testOutput(alice, 690))
+	chain.connect(testBlock(1, pay))
+
+	verified := make(chan struct{})
+	go func() {
+		c.verify(&VerifyTask{})
+		close(verified)
+	}()
+	select {
+	case <-verified:
+		t.Fatal("expect the balances to wait for the index to reach the chain tip")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := c.persistTxHistory(chain.blocks[1]); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-verified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect the verification to finish once the index caught up")
+	}
+	if report, _ := c.GetVerifyReport(); !report.Consistent() || report.ChainHeight != 1 {
+		t.Errorf("expect a consistent index, got %+v", report)
+	}
+}
@@ -0,0 +1,215 @@
+package blockchain
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/common"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	. "github.com/elastos/Elastos.ELA/blockchain"
+)
+
+// walletCursorLength is the length of a wallet history cursor: the height
+// and txid of the last transaction of a page.
+const walletCursorLength = 4 + txidLength
+
+// WalletTxHistory is the history of a transaction as seen by a wallet that
+// owns several addresses. Value and Type are the net effect of the
+// transaction on the whole wallet, Address is the first wallet address
+// taking part in it and Addresses lists all of them.
+type WalletTxHistory struct {
+	types.TransactionHistory
+	Addresses []string
+}
+
+// WalletTxHistoryQuery selects a page of the merged history of the
+// addresses of a wallet, in the order of a TxHistoryQuery. A page starts
+// right after Cursor when it is set, a PageSize of 0 returns every row.
+type WalletTxHistoryQuery struct {
+	Addresses  []string
+	FromHeight uint32
+	ToHeight   uint32
+	PageSize   uint32
+	Cursor     string
+	Descending bool
+}
+
+// NewWalletTxHistoryQuery returns a query for every row of a wallet.
+func NewWalletTxHistoryQuery(addresses []string) WalletTxHistoryQuery {
+	return WalletTxHistoryQuery{
+		Addresses: addresses,
+		ToHeight:  math.MaxUint32,
+	}
+}
+
+// WalletTxHistoryPage is a page of wallet history, NextCursor is empty on
+// the last page.
+type WalletTxHistoryPage struct {
+	History    []WalletTxHistory
+	NextCursor string
+}
+
+// GetWalletTxHistoryPage merges the history of the addresses of a wallet
+// into one row per transaction, ordered by height then txid. A transfer
+// between addresses of the wallet collapses into one spend of its fee.
+//
+// The rows of every address are walked side by side from the store, so a
+// page only reads the rows it returns, whatever the size of the histories.
+func (c ChainStoreExtend) GetWalletTxHistoryPage(query WalletTxHistoryQuery) (*WalletTxHistoryPage, error) {
+	if query.FromHeight > query.ToHeight {
+		return nil, errors.New("invalid range")
+	}
+	var cursor []byte
+	if query.Cursor != "" {
+		var err error
+		cursor, err = hex.DecodeString(query.Cursor)
+		if err != nil || len(cursor) != walletCursorLength {
+			return nil, errors.New("invalid cursor")
+		}
+		if !query.Descending {
+			// skip every role of the transaction of the cursor
+			cursor = append(cursor, 0xff)
+		}
+	}
+
+	streams := &walletStreams{descending: query.Descending}
+	defer streams.release()
+	for i, address := range common.NewStringSet(query.Addresses...).Slice() {
+		prefix, err := txHistoryPrefix(address)
+		if err != nil {
+			return nil, err
+		}
+		s := &walletStream{index: i, address: address, prefix: prefix, iter: c.NewIterator(prefix)}
+		streams.iters = append(streams.iters, s.iter)
+		var ok bool
+		if query.Descending {
+			ok = seekDescending(s.iter, prefix, cursor, query.ToHeight)
+		} else {
+			ok = seekAscending(s.iter, prefix, cursor, query.FromHeight)
+		}
+		if s.inRange(ok, &query) {
+			heap.Push(streams, s)
+		}
+	}
+
+	page := &WalletTxHistoryPage{History: make([]WalletTxHistory, 0)}
+	var last []byte
+	for streams.Len() > 0 {
+		if query.PageSize > 0 && uint32(len(page.History)) == query.PageSize {
+			page.NextCursor = hex.EncodeToString(last)
+			break
+		}
+		w, group, err := streams.merge(&query)
+		if err != nil {
+			return nil, err
+		}
+		page.History = append(page.History, *w)
+		last = group
+	}
+	return page, nil
+}
+
+// walletStream walks the history rows of one address of a wallet.
+type walletStream struct {
+	index   int
+	address string
+	prefix  []byte
+	iter    IIterator
+}
+
+// group returns the height and txid of the current row.
+func (s *walletStream) group() []byte {
+	return s.iter.Key()[len(s.prefix):][:walletCursorLength]
+}
+
+func (s *walletStream) inRange(ok bool, query *WalletTxHistoryQuery) bool {
+	if !ok {
+		return false
+	}
+	height := binary.BigEndian.Uint32(s.iter.Key()[len(s.prefix):])
+	return height >= query.FromHeight && height <= query.ToHeight
+}
+
+// walletStreams is a heap of the streams of a wallet, the stream at the
+// next transaction on top. Streams at the same transaction come in wallet
+// order.
+type walletStreams struct {
+	streams    []*walletStream
+	iters      []IIterator
+	descending bool
+}
+
+func (h *walletStreams) Len() int { return len(h.streams) }
+
+func (h *walletStreams) Less(i, j int) bool {
+	cmp := bytes.Compare(h.streams[i].group(), h.streams[j].group())
+	if cmp == 0 {
+		return h.streams[i].index < h.streams[j].index
+	}
+	if h.descending {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func (h *walletStreams) Swap(i, j int) { h.streams[i], h.streams[j] = h.streams[j], h.streams[i] }
+
+func (h *walletStreams) Push(x interface{}) { h.streams = append(h.streams, x.(*walletStream)) }
+
+func (h *walletStreams) Pop() interface{} {
+	s := h.streams[len(h.streams)-1]
+	h.streams = h.streams[:len(h.streams)-1]
+	return s
+}
+
+func (h *walletStreams) release() {
+	for _, iter := range h.iters {
+		iter.Release()
+	}
+}
+
+// merge reads every row of the transaction on top of the heap into one
+// wallet row, and returns it with the height and txid of the transaction.
+func (h *walletStreams) merge(query *WalletTxHistoryQuery) (*WalletTxHistory, []byte, error) {
+	group := append([]byte{}, h.streams[0].group()...)
+	var w *WalletTxHistory
+	var net int64
+	for h.Len() > 0 && bytes.Equal(h.streams[0].group(), group) {
+		s := heap.Pop(h).(*walletStream)
+		ok := true
+		for ; ok && bytes.Equal(s.group(), group); ok = advance(s.iter, query.Descending) {
+			txh, err := decodeTxHistory(s.iter.Value())
+			if err != nil {
+				return nil, nil, err
+			}
+			if w == nil {
+				w = &WalletTxHistory{TransactionHistory: *txh}
+				w.Fee = 0
+			}
+			if n := len(w.Addresses); n == 0 || w.Addresses[n-1] != s.address {
+				w.Addresses = append(w.Addresses, s.address)
+			}
+			if txh.Type == SPEND {
+				net -= int64(txh.Value)
+				w.Fee = txh.Fee
+			} else {
+				net += int64(txh.Value)
+			}
+		}
+		if s.inRange(ok, query) {
+			heap.Push(h, s)
+		}
+	}
+	if net < 0 {
+		w.Type = SPEND
+		w.Value = uint64(-net)
+	} else {
+		w.Type = INCOME
+		w.Value = uint64(net)
+	}
+	return w, group, nil
+}
@@ -0,0 +1,130 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	types2 "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func Test_GetWalletTxHistory(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	alice, aliceAddr := testAddress(1)
+	bob, bobAddr := testAddress(2)
+	carol, _ := testAddress(3)
+
+	coinbase := testCoinbase(0, testOutput(alice, 1000))
+	internal := testTransfer([]*types2.Input{testInput(coinbase, 0)}, testOutput(bob, 600), testOutput(alice, 390))
+	external := testTransfer([]*types2.Input{testInput(internal, 0)}, testOutput(carol, 500), testOutput(bob, 95))
+	for h, tx := range []*types2.Transaction{coinbase, internal, external} {
+		b := testBlock(uint32(h), tx)
+		chain.connect(b)
+		if err := c.persistTxHistory(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := c.GetWalletTxHistoryPage(NewWalletTxHistoryQuery([]string{bobAddr, aliceAddr, bobAddr}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txhs := page.History
+	type row struct {
+		height    uint64
+		kind      string
+		value     uint64
+		fee       uint64
+		addresses []string
+	}
+	expect := []row{
+		{0, INCOME, 1000, 0, []string{aliceAddr}},
+		{1, SPEND, 10, 10, []string{bobAddr, aliceAddr}},
+		{2, SPEND, 505, 5, []string{bobAddr}},
+	}
+	var got []row
+	for _, txh := range txhs {
+		got = append(got, row{txh.Height, txh.Type, txh.Value, txh.Fee, txh.Addresses})
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect wallet history %+v, got %+v", expect, got)
+	}
+}
+
+func Test_GetWalletTxHistoryPage(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	testChain(chain, 6)
+	if closed, err := c.catchUp(chain.GetHeight()); closed != nil || err != nil {
+		t.Fatal(closed, err)
+	}
+	_, aliceAddr := testAddress(1)
+	_, bobAddr := testAddress(2)
+	full, err := c.GetWalletTxHistoryPage(NewWalletTxHistoryQuery([]string{aliceAddr, bobAddr}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(q *WalletTxHistoryQuery)
+		expect []uint64
+	}{
+		{"ascending", func(q *WalletTxHistoryQuery) {}, []uint64{0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5}},
+		{"descending", func(q *WalletTxHistoryQuery) { q.Descending = true }, []uint64{5, 5, 4, 4, 3, 3, 2, 2, 1, 1, 0}},
+		{"height range", func(q *WalletTxHistoryQuery) { q.FromHeight = 2; q.ToHeight = 3 }, []uint64{2, 2, 3, 3}},
+		{"descending range", func(q *WalletTxHistoryQuery) { q.FromHeight = 2; q.ToHeight = 3; q.Descending = true }, []uint64{3, 3, 2, 2}},
+	}
+	for _, test := range tests {
+		q := NewWalletTxHistoryQuery([]string{aliceAddr, bobAddr})
+		test.modify(&q)
+		q.PageSize = 3
+		var all []WalletTxHistory
+		for {
+			page, err := c.GetWalletTxHistoryPage(q)
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+			if len(page.History) > 3 {
+				t.Fatalf("%s: expect pages of 3 rows, got %d", test.name, len(page.History))
+			}
+			all = append(all, page.History...)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		var hs []uint64
+		for _, w := range all {
+			hs = append(hs, w.Height)
+		}
+		if !equalHeights(hs, test.expect) {
+			t.Errorf("%s: expect heights %v, got %v", test.name, test.expect, hs)
+		}
+	}
+
+	// paging returns the rows of the whole history
+	q := NewWalletTxHistoryQuery([]string{aliceAddr, bobAddr})
+	q.PageSize = 4
+	var all []WalletTxHistory
+	for {
+		page, err := c.GetWalletTxHistoryPage(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, page.History...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if !reflect.DeepEqual(all, full.History) {
+		t.Errorf("expect the pages to add up to %+v, got %+v", full.History, all)
+	}
+
+	q = NewWalletTxHistoryQuery([]string{aliceAddr})
+	q.Cursor = "00"
+	if _, err := c.GetWalletTxHistoryPage(q); err == nil {
+		t.Error("expect an invalid cursor to be rejected")
+	}
+}
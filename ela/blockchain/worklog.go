@@ -0,0 +1,230 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/common/log"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+const (
+	// workRollback asks for the rows indexed at the height and above to be
+	// removed.
+	workRollback byte = 0x01
+	// workIndex asks for the chain to be indexed up to the height.
+	workIndex byte = 0x02
+
+	// workPollInterval is how often the loop looks at the work log when no
+	// new work wakes it up.
+	workPollInterval = 5 * time.Second
+	// drainMaxBlocks is the most blocks indexed while draining the work log
+	// on shutdown.
+	drainMaxBlocks = 100
+)
+
+// work is an entry of the work log: what is left to do at a block height.
+// A rollback logged at a height is kept when the block replacing the
+// detached one is logged, so the rollback always runs first.
+type work struct {
+	Flags byte
+}
+
+func (w *work) Serialize() []byte {
+	return []byte{w.Flags}
+}
+
+func (w *work) Deserialize(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid work log entry")
+	}
+	w.Flags = data[0]
+	return nil
+}
+
+// workLog serializes the writers of the work log with the loop removing the
+// entries it completed.
+type workLog struct {
+	sync.Mutex
+	wake chan struct{}
+}
+
+func newWorkLog() *workLog {
+	return &workLog{wake: make(chan struct{}, 1)}
+}
+
+// IndexLag tells how far the index is behind the chain. Quarantined lists
+// the heights indexed without their rows.
+type IndexLag struct {
+	ChainHeight   uint32   `json:"chainheight"`
+	IndexedHeight uint32   `json:"indexedheight"`
+	Indexed       bool     `json:"indexed"`
+	Lag           uint32   `json:"lag"`
+	Queued        uint32   `json:"queued"`
+	OldestQueued  uint32   `json:"oldestqueued"`
+	Quarantined   []uint32 `json:"quarantined"`
+}
+
+// key: DataWorkLogPrefix + height
+// value: flags
+func workKey(height uint32) []byte {
+	key := make([]byte, 5)
+	key[0] = byte(DataWorkLogPrefix)
+	binary.BigEndian.PutUint32(key[1:], height)
+	return key
+}
+
+// logBlock records that a block was saved in the chain store and has to be
+// indexed. It never waits for the loop.
+func (c ChainStoreExtend) logBlock(block *Block) error {
+	return c.logWork(block.Height, func(w *work) {
+		w.Flags |= workIndex
+	})
+}
+
+// logRollback records that a block was detached from the chain, dropping
+// the indexing of that block if it was still waiting.
+func (c ChainStoreExtend) logRollback(block *Block) error {
+	return c.logWork(block.Height, func(w *work) {
+		w.Flags = workRollback
+	})
+}
+
+func (c ChainStoreExtend) logWork(height uint32, merge func(w *work)) error {
+	c.workLog.Lock()
+	defer c.workLog.Unlock()
+	w := new(work)
+	if data, err := c.Get(workKey(height)); err == nil {
+		if err := w.Deserialize(data); err != nil {
+			return err
+		}
+	}
+	merge(w)
+	if err := c.Put(workKey(height), w.Serialize()); err != nil {
+		return err
+	}
+	select {
+	case c.workLog.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// processWorkLog applies the work log in height order. An entry is removed
+// once the checkpoint shows it done, so work interrupted by a crash is done
+// again on restart: indexing a block is skipped when the checkpoint already
+// covers it. Entries more than maxBlocks above the checkpoint are left for
+// later. It returns the close request if CloseEx was called while blocks
+// were being indexed.
+func (c ChainStoreExtend) processWorkLog(maxBlocks uint32) chan bool {
+	iter := c.NewIterator([]byte{byte(DataWorkLogPrefix)})
+	type entry struct {
+		height uint32
+		value  []byte
+	}
+	var entries []entry
+	for iter.Next() {
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
+		entries = append(entries, entry{binary.BigEndian.Uint32(iter.Key()[1:]), value})
+	}
+	iter.Release()
+
+	if c.failure.waiting() {
+		return nil
+	}
+	for _, e := range entries {
+		w := new(work)
+		if err := w.Deserialize(e.value); err != nil {
+			log.Errorf("work log at height %d: %s", e.height, err)
+			c.completeWork(e.height, e.value)
+			continue
+		}
+		if w.Flags&workIndex != 0 {
+			var next uint64
+			if indexed, ok := c.getIndexedHeight(); ok {
+				next = uint64(indexed) + 1
+			}
+			if uint64(e.height) >= next+uint64(maxBlocks) {
+				return nil
+			}
+		}
+		now := time.Now()
+		closed, err := c.applyWork(e.height, w)
+		if closed != nil {
+			return closed
+		}
+		if err != nil {
+			// later heights depend on this one, retry it after a while
+			c.indexFailed(e.height, err)
+			return nil
+		}
+		c.failure.clear()
+		c.completeWork(e.height, e.value)
+		tcall := float64(time.Now().Sub(now)) / float64(time.Second)
+		log.Debugf("handle work log time cost: %g height:%d", tcall, e.height)
+	}
+	return nil
+}
+
+// drainWorkLog applies the work left in the log before the loop stops. A
+// long way behind the chain the rest is left to the next start, the log
+// keeps it.
+func (c ChainStoreExtend) drainWorkLog() {
+	c.processWorkLog(drainMaxBlocks)
+	if lag := c.GetIndexLag(); lag.Queued > 0 {
+		log.Infof("%d blocks left in the work log, they are indexed on the next start", lag.Queued)
+	}
+}
+
+func (c ChainStoreExtend) applyWork(height uint32, w *work) (chan bool, error) {
+	if w.Flags&workRollback != 0 {
+		if err := c.rollbackToHeight(height); err != nil {
+			return nil, fmt.Errorf("rollback block at height %d: %s", height, err)
+		}
+	}
+	if w.Flags&workIndex == 0 {
+		return nil, nil
+	}
+	return c.catchUp(height)
+}
+
+// completeWork removes an entry unless it was rewritten since it was read.
+func (c ChainStoreExtend) completeWork(height uint32, value []byte) {
+	c.workLog.Lock()
+	defer c.workLog.Unlock()
+	data, err := c.Get(workKey(height))
+	if err != nil || !bytes.Equal(data, value) {
+		return
+	}
+	if err := c.Delete(workKey(height)); err != nil {
+		log.Errorf("remove work log at height %d failed: %s", height, err)
+	}
+}
+
+// GetIndexLag returns how far the index is behind the chain, the work
+// waiting in the work log and the quarantined blocks.
+func (c ChainStoreExtend) GetIndexLag() IndexLag {
+	lag := IndexLag{ChainHeight: c.GetHeight(), Quarantined: make([]uint32, 0)}
+	lag.Quarantined = append(lag.Quarantined, c.QuarantinedHeights(math.MaxUint32)...)
+	lag.IndexedHeight, lag.Indexed = c.getIndexedHeight()
+	if !lag.Indexed {
+		lag.Lag = lag.ChainHeight + 1
+	} else if lag.ChainHeight > lag.IndexedHeight {
+		lag.Lag = lag.ChainHeight - lag.IndexedHeight
+	}
+	iter := c.NewIterator([]byte{byte(DataWorkLogPrefix)})
+	defer iter.Release()
+	for iter.Next() {
+		if lag.Queued == 0 {
+			lag.OldestQueued = binary.BigEndian.Uint32(iter.Key()[1:])
+		}
+		lag.Queued++
+	}
+	return lag
+}
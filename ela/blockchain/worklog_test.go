@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_WorkLog(t *testing.T) {
+	chain := newTestChainStore()
+	st := newMemStore(t)
+	c := newChainStoreEx(chain, st)
+	miner, minerAddr := testAddress(1)
+	for h := uint32(0); h < 3; h++ {
+		b := testBlock(h, testCoinbase(h, testOutput(miner, 100)))
+		chain.connect(b)
+		c.AddTask(b)
+	}
+	lag := c.GetIndexLag()
+	if lag.Indexed || lag.Lag != 3 || lag.Queued != 3 || lag.OldestQueued != 0 {
+		t.Fatalf("expect three queued blocks, got %+v", lag)
+	}
+
+	// a store opened again after a crash finds the queued blocks
+	c = newChainStoreEx(chain, st)
+	if closed := c.processWorkLog(math.MaxUint32); closed != nil {
+		t.Fatal("unexpected close request")
+	}
+	if lag := c.GetIndexLag(); lag.IndexedHeight != 2 || lag.Lag != 0 || lag.Queued != 0 {
+		t.Fatalf("expect the queued blocks indexed, got %+v", lag)
+	}
+
+	// work already covered by the checkpoint is only removed
+	c.AddTask(chain.blocks[1])
+	c.processWorkLog(math.MaxUint32)
+	if n := len(c.GetTxHistory(minerAddr)); n != 3 || c.GetIndexLag().Queued != 0 {
+		t.Errorf("expect three rows and an empty work log, got %d rows", n)
+	}
+}
+
+func Test_WorkLogRollback(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	minerA, addrA := testAddress(1)
+	minerB, addrB := testAddress(2)
+	for h := uint32(0); h < 3; h++ {
+		b := testBlock(h, testCoinbase(h, testOutput(minerA, 100)))
+		chain.connect(b)
+		c.AddTask(b)
+	}
+	c.processWorkLog(math.MaxUint32)
+
+	// the tip is replaced before the loop sees the rollback
+	c.AddTask(&RollbackTask{Block: chain.disconnect()})
+	fork := testBlock(2, testCoinbase(2, testOutput(minerB, 100)))
+	chain.connect(fork)
+	c.AddTask(fork)
+	if lag := c.GetIndexLag(); lag.Queued != 1 {
+		t.Fatalf("expect the rollback and the block merged, got %+v", lag)
+	}
+	c.processWorkLog(math.MaxUint32)
+	if len(c.GetTxHistory(addrA)) != 2 || len(c.GetTxHistory(addrB)) != 1 {
+		t.Errorf("expect the fork indexed in place of the detached block")
+	}
+
+	// a rollback alone leaves the checkpoint below the detached block
+	c.AddTask(&RollbackTask{Block: chain.disconnect()})
+	c.processWorkLog(math.MaxUint32)
+	if lag := c.GetIndexLag(); lag.IndexedHeight != 1 || lag.Queued != 0 {
+		t.Errorf("expect the index rolled back to height 1, got %+v", lag)
+	}
+}
+
+func Test_CompleteWorkRewritten(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	b := testBlock(0, testCoinbase(0))
+	c.AddTask(&RollbackTask{Block: b})
+	read, _ := c.Get(workKey(0))
+	c.AddTask(b)
+	c.completeWork(0, read)
+	if c.GetIndexLag().Queued != 1 {
+		t.Error("expect work logged after it was read to be kept")
+	}
+}
+
+func Test_CloseExDrainsWorkLog(t *testing.T) {
+	chain := newTestChainStore()
+	c := newChainStoreEx(chain, newMemStore(t))
+	miner, _ := testAddress(1)
+	for h := uint32(0); h < 5; h++ {
+		chain.connect(testBlock(h, testCoinbase(h, testOutput(miner, 100))))
+	}
+	go c.loop()
+	for _, b := range chain.blocks {
+		c.AddTask(b)
+	}
+	c.CloseEx()
+	if lag := c.GetIndexLag(); lag.IndexedHeight != 4 || lag.Queued != 0 {
+		t.Errorf("expect the work log drained on close, got %+v", lag)
+	}
+}
@@ -0,0 +1,85 @@
+package types
+
+import (
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// CrossChainRecord links a main chain transaction to the side chain. A
+// deposit record carries the side chain address and the amount it receives,
+// a withdrawal record the side chain transaction it pays out.
+type CrossChainRecord struct {
+	Txid          string
+	TxType        string
+	Height        uint64
+	CreateTime    uint64
+	Address       string
+	Amount        uint64
+	SideChainTxid string
+}
+
+func (cr *CrossChainRecord) Serialize(w io.Writer) error {
+	err := common.WriteVarString(w, cr.Txid)
+	if err != nil {
+		return errors.New("[CrossChainRecord], Txid serialize failed.")
+	}
+	err = common.WriteVarString(w, cr.TxType)
+	if err != nil {
+		return errors.New("[CrossChainRecord], TxType serialize failed.")
+	}
+	err = common.WriteUint64(w, cr.Height)
+	if err != nil {
+		return errors.New("[CrossChainRecord], Height serialize failed.")
+	}
+	err = common.WriteUint64(w, cr.CreateTime)
+	if err != nil {
+		return errors.New("[CrossChainRecord], CreateTime serialize failed.")
+	}
+	err = common.WriteVarString(w, cr.Address)
+	if err != nil {
+		return errors.New("[CrossChainRecord], Address serialize failed.")
+	}
+	err = common.WriteUint64(w, cr.Amount)
+	if err != nil {
+		return errors.New("[CrossChainRecord], Amount serialize failed.")
+	}
+	err = common.WriteVarString(w, cr.SideChainTxid)
+	if err != nil {
+		return errors.New("[CrossChainRecord], SideChainTxid serialize failed.")
+	}
+	return nil
+}
+
+func (cr *CrossChainRecord) Deserialize(r io.Reader) error {
+	var err error
+	cr.Txid, err = common.ReadVarString(r)
+	if err != nil {
+		return errors.New("[CrossChainRecord], Txid deserialize failed.")
+	}
+	cr.TxType, err = common.ReadVarString(r)
+	if err != nil {
+		return errors.New("[CrossChainRecord], TxType deserialize failed.")
+	}
+	cr.Height, err = common.ReadUint64(r)
+	if err != nil {
+		return errors.New("[CrossChainRecord], Height deserialize failed.")
+	}
+	cr.CreateTime, err = common.ReadUint64(r)
+	if err != nil {
+		return errors.New("[CrossChainRecord], CreateTime deserialize failed.")
+	}
+	cr.Address, err = common.ReadVarString(r)
+	if err != nil {
+		return errors.New("[CrossChainRecord], Address deserialize failed.")
+	}
+	cr.Amount, err = common.ReadUint64(r)
+	if err != nil {
+		return errors.New("[CrossChainRecord], Amount deserialize failed.")
+	}
+	cr.SideChainTxid, err = common.ReadVarString(r)
+	if err != nil {
+		return errors.New("[CrossChainRecord], SideChainTxid deserialize failed.")
+	}
+	return nil
+}
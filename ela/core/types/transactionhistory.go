@@ -7,6 +7,10 @@ import (
 	"io"
 )
 
+// TxStatusPending marks the rows of a transaction still in the transaction
+// pool. Status is never stored, confirmed rows leave it empty.
+const TxStatusPending = "pending"
+
 type TransactionHistory struct {
 	Address    string
 	Txid       string
@@ -19,6 +23,22 @@ type TransactionHistory struct {
 	Outputs    []string
 	TxType     string
 	Memo       string
+
+	// Cross chain metadata. Deposits list the side chain addresses and the
+	// amounts they receive, withdrawals the side chain transactions they
+	// pay out.
+	CrossChainAddresses []string
+	CrossChainAmounts   []uint64
+	SideChainTxids      []string
+
+	// DPoS detail: the candidates voted by the address, the owner key of a
+	// registered, updated or cancelled producer and the deposit paid or
+	// returned.
+	Votes            []string
+	ProducerOwnerKey string
+	DepositAmount    uint64
+
+	Status string `json:",omitempty"`
 }
 
 func (th *TransactionHistory) Serialize(w io.Writer) error {
@@ -78,6 +98,36 @@ func (th *TransactionHistory) Serialize(w io.Writer) error {
 	if err != nil {
 		return errors.New("[TransactionHistory], Memo serialize failed.")
 	}
+	err = writeStrings(w, th.CrossChainAddresses)
+	if err != nil {
+		return errors.New("[TransactionHistory], CrossChainAddresses serialize failed.")
+	}
+	err = common.WriteVarUint(w, uint64(len(th.CrossChainAmounts)))
+	if err != nil {
+		return errors.New("[TransactionHistory], Length of CrossChainAmounts serialize failed.")
+	}
+	for _, amount := range th.CrossChainAmounts {
+		err = common.WriteUint64(w, amount)
+		if err != nil {
+			return errors.New("[TransactionHistory], CrossChainAmounts serialize failed.")
+		}
+	}
+	err = writeStrings(w, th.SideChainTxids)
+	if err != nil {
+		return errors.New("[TransactionHistory], SideChainTxids serialize failed.")
+	}
+	err = writeStrings(w, th.Votes)
+	if err != nil {
+		return errors.New("[TransactionHistory], Votes serialize failed.")
+	}
+	err = common.WriteVarString(w, th.ProducerOwnerKey)
+	if err != nil {
+		return errors.New("[TransactionHistory], ProducerOwnerKey serialize failed.")
+	}
+	err = common.WriteUint64(w, th.DepositAmount)
+	if err != nil {
+		return errors.New("[TransactionHistory], DepositAmount serialize failed.")
+	}
 	return nil
 }
 
@@ -141,9 +191,92 @@ func (th *TransactionHistory) Deserialize(r io.Reader) error {
 	if err != nil {
 		return errors.New("[TransactionHistory], Memo serialize failed.")
 	}
+	// rows written before the cross chain metadata existed end here
+	if atEOF(r) {
+		return nil
+	}
+	th.CrossChainAddresses, err = readStrings(r)
+	if err != nil {
+		return errors.New("[TransactionHistory], CrossChainAddresses deserialize failed.")
+	}
+	n, err = common.ReadVarUint(r, 0)
+	if err != nil {
+		return errors.New("[TransactionHistory], length of CrossChainAmounts deserialize failed.")
+	}
+	for i := uint64(0); i < n; i++ {
+		amount, err := common.ReadUint64(r)
+		if err != nil {
+			return errors.New("[TransactionHistory], CrossChainAmounts deserialize failed.")
+		}
+		th.CrossChainAmounts = append(th.CrossChainAmounts, amount)
+	}
+	th.SideChainTxids, err = readStrings(r)
+	if err != nil {
+		return errors.New("[TransactionHistory], SideChainTxids deserialize failed.")
+	}
+	// rows written before the DPoS detail existed end here
+	if atEOF(r) {
+		return nil
+	}
+	th.Votes, err = readStrings(r)
+	if err != nil {
+		return errors.New("[TransactionHistory], Votes deserialize failed.")
+	}
+	th.ProducerOwnerKey, err = common.ReadVarString(r)
+	if err != nil {
+		return errors.New("[TransactionHistory], ProducerOwnerKey deserialize failed.")
+	}
+	th.DepositAmount, err = common.ReadUint64(r)
+	if err != nil {
+		return errors.New("[TransactionHistory], DepositAmount deserialize failed.")
+	}
+	return nil
+}
+
+func writeStrings(w io.Writer, strs []string) error {
+	err := common.WriteVarUint(w, uint64(len(strs)))
+	if err != nil {
+		return err
+	}
+	for _, str := range strs {
+		err = common.WriteVarString(w, str)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func readStrings(r io.Reader) ([]string, error) {
+	n, err := common.ReadVarUint(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	var strs []string
+	for i := uint64(0); i < n; i++ {
+		str, err := common.ReadVarString(r)
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, str)
+	}
+	return strs, nil
+}
+
+// atEOF reports whether nothing is left to read. Readers that cannot unread
+// a byte are assumed to hold more data.
+func atEOF(r io.Reader) bool {
+	s, ok := r.(io.ByteScanner)
+	if !ok {
+		return false
+	}
+	if _, err := s.ReadByte(); err != nil {
+		return err == io.EOF
+	}
+	s.UnreadByte()
+	return false
+}
+
 func (th TransactionHistory) String() string {
 	return fmt.Sprintf("addr: %s,txid: %s,value: %d,height: %d", th.Address, th.Txid, th.Value, th.Height)
 }
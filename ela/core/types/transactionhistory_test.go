@@ -1,6 +1,8 @@
 package types
 
 import (
+	"bytes"
+	"reflect"
 	"sort"
 	"testing"
 )
@@ -18,3 +20,49 @@ func TestSort(t *testing.T) {
 	}
 	sort.Sort(t0)
 }
+
+func TestCrossChainRoundTrip(t *testing.T) {
+	th := TransactionHistory{
+		Address:             "EXAMPLE",
+		Txid:                "00",
+		Type:                "spend",
+		Memo:                "deposit",
+		CrossChainAddresses: []string{"EID1", "EID2"},
+		CrossChainAmounts:   []uint64{100, 200},
+		SideChainTxids:      []string{"aa"},
+		Votes:               []string{"02aa", "03bb"},
+		ProducerOwnerKey:    "02cc",
+		DepositAmount:       500000000000,
+	}
+	buf := new(bytes.Buffer)
+	if err := th.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	var got TransactionHistory
+	if err := got.Deserialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, th) {
+		t.Errorf("expect %+v, got %+v", th, got)
+	}
+}
+
+func TestDeserializeOlderRows(t *testing.T) {
+	th := TransactionHistory{Address: "EXAMPLE", Txid: "00", Memo: "legacy"}
+	buf := new(bytes.Buffer)
+	if err := th.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	// the empty DPoS detail takes 10 bytes and the three empty cross chain
+	// lists before it 3 more
+	for _, cut := range []int{10, 13} {
+		legacy := buf.Bytes()[:buf.Len()-cut]
+		var got TransactionHistory
+		if err := got.Deserialize(bytes.NewReader(legacy)); err != nil {
+			t.Fatal(err)
+		}
+		if got.Memo != "legacy" || got.CrossChainAddresses != nil || got.Votes != nil {
+			t.Errorf("unexpected row %+v without its last %d bytes", got, cut)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package ela
 
 import (
+	"flag"
 	. "github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/pow"
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/servers"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/servers/httpjsonrpc"
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/servers/httprestful"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/webhook"
 	"github.com/elastos/Elastos.ELA.Utility/signal"
 	"github.com/elastos/Elastos.ELA/blockchain"
 	"github.com/elastos/Elastos.ELA/blockchain/interfaces"
@@ -16,7 +19,6 @@ import (
 	"github.com/elastos/Elastos.ELA/dpos/store"
 	"github.com/elastos/Elastos.ELA/node"
 	"github.com/elastos/Elastos.ELA/protocol"
-	"github.com/elastos/Elastos.ELA/servers/httpjsonrpc"
 	"github.com/elastos/Elastos.ELA/servers/httpnodeinfo"
 	"github.com/elastos/Elastos.ELA/servers/httpwebsocket"
 	"github.com/elastos/Elastos.ELA/version/verconfig"
@@ -29,6 +31,12 @@ const (
 	DefaultMultiCoreNum = 4
 )
 
+var (
+	reindex     = flag.Bool("reindex", false, "wipe the transaction history index and rebuild it from genesis")
+	verifyIndex = flag.Bool("verifyindex", false, "check the transaction history index against the chain and log mismatches")
+	repairIndex = flag.Bool("repairindex", false, "check the transaction history index and re-index the inconsistent heights")
+)
+
 func init() {
 	log.Init(
 		config.Parameters.PrintLevel,
@@ -76,7 +84,8 @@ func Go() {
 	log.Info("BlockChain init")
 	versions := verconfig.InitVersions()
 	var dposStore interfaces.IDposStore
-	var chainStoreEx IChainStoreExtend
+	var chainStoreEx ChainStoreExtend
+	var dispatcher *webhook.Dispatcher
 	chainStore, err := blockchain.NewChainStore(filepath.Join(config.DataPath, config.DataDir, config.ChainDir))
 	if err != nil {
 		goto ERROR
@@ -87,6 +96,14 @@ func Go() {
 		goto ERROR
 	}
 	defer chainStoreEx.CloseEx()
+	dispatcher, err = webhook.NewDispatcher(chainStoreEx)
+	if err != nil {
+		goto ERROR
+	}
+	chainStoreEx.RegisterHistoryListener(dispatcher)
+	dispatcher.Start()
+	defer dispatcher.Stop()
+	webhook.DefaultDispatcher = dispatcher
 	dposStore, err = store.NewDposStore(filepath.Join(config.DataPath, config.DataDir, config.DposDir))
 	if err != nil {
 		goto ERROR
@@ -96,6 +113,10 @@ func Go() {
 	if err != nil {
 		goto ERROR
 	}
+	chainStoreEx.AddTask(&ReindexTask{FromGenesis: *reindex})
+	if *verifyIndex || *repairIndex {
+		chainStoreEx.StartVerify(*repairIndex)
+	}
 	store.InitArbitrators(store.ArbitratorsConfig{
 		ArbitratorsCount: config.ArbitratorsCount,
 		CandidatesCount:  config.Parameters.ArbiterConfiguration.CandidatesCount,
@@ -133,6 +154,7 @@ func Go() {
 	servers.ServerNode = noder
 	servers.ServerNode.RegisterTxPoolListener(arbitrator)
 	servers.ServerNode.RegisterTxPoolListener(chainStore)
+	chainStoreEx.WatchTxPool(noder)
 	servers.LocalPow = pow.NewPowService()
 
 	log.Info("Start services")
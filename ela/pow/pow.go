@@ -336,6 +336,7 @@ func (pow *PowService) Halt() {
 
 func (pow *PowService) RollbackTransaction(v interface{}) {
 	if block, ok := v.(*Block); ok {
+		blockchain.DefaultChainStoreEx.AddTask(&blockchain.RollbackTask{Block: block})
 		for _, tx := range block.Transactions[1:] {
 			err := node.LocalNode.MaybeAcceptTransaction(tx)
 			if err == nil {
@@ -344,6 +345,7 @@ func (pow *PowService) RollbackTransaction(v interface{}) {
 				log.Error(err)
 			}
 		}
+		blockchain.DefaultChainStoreEx.OnTxPoolChanged()
 	}
 }
 
@@ -356,6 +358,7 @@ func (pow *PowService) BlockPersistCompleted(v interface{}) {
 		if err != nil {
 			log.Warn(err)
 		}
+		blockchain.DefaultChainStoreEx.OnTxPoolChanged()
 		node.LocalNode.SetHeight(uint64(DefaultLedger.Blockchain.GetBestHeight()))
 
 		hash := block.Hash()
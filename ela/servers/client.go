@@ -0,0 +1,27 @@
+package servers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/elastos/Elastos.ELA/common/config"
+)
+
+// AllowAdmin reports whether the client of a request may use the admin
+// apis: local clients and the white listed ips of the rpc configuration.
+// The json rpc server serves no other client.
+func AllowAdmin(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, allowed := range config.Parameters.RpcConfiguration.WhiteIPList {
+		if allowed == host || allowed == "0.0.0.0" {
+			return true
+		}
+	}
+	return false
+}
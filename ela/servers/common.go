@@ -1,6 +1,7 @@
 package servers
 
 import (
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
 	"github.com/elastos/Elastos.ELA/common"
 	. "github.com/elastos/Elastos.ELA/core/types"
 	"github.com/elastos/Elastos.ELA/core/types/outputpayload"
@@ -28,6 +29,8 @@ type OutputInfo struct {
 	OutputLock    uint32            `json:"outputlock"`
 	OutputType    uint32            `json:"type"`
 	OutputPayload OutputPayloadInfo `json:"payload"`
+	Spent         bool              `json:"spent"`
+	SpentBy       string            `json:"spentby,omitempty"`
 }
 
 type OutputPayloadInfo interface{}
@@ -187,3 +190,108 @@ type UTXOInfo struct {
 	OutputLock    uint32 `json:"outputlock"`
 	Confirmations uint32 `json:"confirmations"`
 }
+
+type BalanceSnapshotInfo struct {
+	Height  uint32 `json:"height"`
+	Time    uint64 `json:"time"`
+	Balance string `json:"balance"`
+	// Quarantined lists the heights up to the reply of the blocks indexed
+	// without their rows. The values of the reply miss their changes.
+	Quarantined []uint32 `json:"quarantined,omitempty"`
+}
+
+type BalanceAtInfo struct {
+	Address     string               `json:"address"`
+	Balance     string               `json:"balance"`
+	LastChange  *BalanceSnapshotInfo `json:"lastchange"`
+	Quarantined []uint32             `json:"quarantined,omitempty"`
+}
+
+type AddressSummaryInfo struct {
+	Address     string   `json:"address"`
+	Received    string   `json:"received"`
+	Sent        string   `json:"sent"`
+	Fees        string   `json:"fees"`
+	TxCount     uint64   `json:"txcount"`
+	FirstHeight uint32   `json:"firstheight"`
+	FirstTime   uint64   `json:"firsttime"`
+	LastHeight  uint32   `json:"lastheight"`
+	LastTime    uint64   `json:"lasttime"`
+	Quarantined []uint32 `json:"quarantined,omitempty"`
+}
+
+type RichListEntryInfo struct {
+	Rank        uint64   `json:"rank"`
+	Address     string   `json:"address"`
+	Balance     string   `json:"balance"`
+	Quarantined []uint32 `json:"quarantined,omitempty"`
+}
+
+type RichListInfo struct {
+	Holders     uint64              `json:"holders"`
+	Entries     []RichListEntryInfo `json:"entries"`
+	Quarantined []uint32            `json:"quarantined,omitempty"`
+}
+
+type AddressBalanceInfo struct {
+	Address string `json:"address"`
+	Balance string `json:"balance"`
+}
+
+type WalletBalanceInfo struct {
+	Balance   string               `json:"balance"`
+	Addresses []AddressBalanceInfo `json:"addresses"`
+}
+
+// TxHistoryInfo is a history row with its amounts in ELA. Its fields keep
+// the names of the row they are made from.
+type TxHistoryInfo struct {
+	Address             string
+	Txid                string
+	Type                string
+	Value               string
+	CreateTime          uint64
+	Height              uint64
+	Fee                 string
+	Inputs              []string
+	Outputs             []string
+	TxType              string
+	Memo                string
+	CrossChainAddresses []string
+	CrossChainAmounts   []string
+	SideChainTxids      []string
+	Votes               []string
+	ProducerOwnerKey    string
+	DepositAmount       string
+	Status              string `json:",omitempty"`
+}
+
+type TxHistoryPageInfo struct {
+	History    []TxHistoryInfo
+	Total      *uint64 `json:",omitempty"`
+	NextCursor string
+}
+
+type WalletTxHistoryInfo struct {
+	TxHistoryInfo
+	Addresses []string
+}
+
+type WalletTxHistoryPageInfo struct {
+	History    []WalletTxHistoryInfo
+	NextCursor string
+}
+
+// SpentByInfo is the input spending an output.
+type SpentByInfo struct {
+	TxID   string `json:"txid"`
+	VIn    uint16 `json:"vin"`
+	Height uint32 `json:"height"`
+}
+
+// IndexVerifyInfo tells whether an index verification is running, along
+// with the report of the last one finished.
+type IndexVerifyInfo struct {
+	Running bool                     `json:"running"`
+	Report  *blockchain.VerifyReport `json:"report"`
+}
@@ -0,0 +1,133 @@
+package servers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	"github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/errors"
+)
+
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+)
+
+// TxHistoryExportRow is a history row as exported, amounts in ELA.
+type TxHistoryExportRow struct {
+	Address string `json:"address"`
+	Txid    string `json:"txid"`
+	Height  uint64 `json:"height"`
+	Time    string `json:"time"`
+	Type    string `json:"type"`
+	TxType  string `json:"txtype"`
+	Value   string `json:"value"`
+	Fee     string `json:"fee"`
+	Memo    string `json:"memo"`
+	Inputs  string `json:"inputs"`
+	Outputs string `json:"outputs"`
+}
+
+// formulaPrefixes are the first characters of a spreadsheet formula.
+const formulaPrefixes = "=+-@\t\r"
+
+var txHistoryExportHeader = []string{"address", "txid", "height", "time", "type",
+	"txtype", "value", "fee", "memo", "inputs", "outputs"}
+
+func newTxHistoryExportRow(txh *types.TransactionHistory) *TxHistoryExportRow {
+	return &TxHistoryExportRow{
+		Address: txh.Address,
+		Txid:    txh.Txid,
+		Height:  txh.Height,
+		Time:    time.Unix(int64(txh.CreateTime), 0).UTC().Format(time.RFC3339),
+		Type:    txh.Type,
+		TxType:  txh.TxType,
+		Value:   common.Fixed64(txh.Value).String(),
+		Fee:     common.Fixed64(txh.Fee).String(),
+		Memo:    txh.Memo,
+		Inputs:  strings.Join(txh.Inputs, " "),
+		Outputs: strings.Join(txh.Outputs, " "),
+	}
+}
+
+// record returns the cells of a csv line. A spreadsheet reads a cell
+// starting with one of formulaPrefixes as a formula, so such a cell, a memo
+// being any text, is escaped with a leading quote.
+func (r *TxHistoryExportRow) record() []string {
+	record := []string{r.Address, r.Txid, strconv.FormatUint(r.Height, 10), r.Time,
+		r.Type, r.TxType, r.Value, r.Fee, r.Memo, r.Inputs, r.Outputs}
+	for i, cell := range record {
+		if cell != "" && strings.ContainsRune(formulaPrefixes, rune(cell[0])) {
+			record[i] = "'" + cell
+		}
+	}
+	return record
+}
+
+// HistoryExport streams the history of an address in one of the export
+// formats.
+type HistoryExport struct {
+	Address     string
+	Format      string
+	ContentType string
+	Write       func(w io.Writer) error
+}
+
+// GetHistoryExport checks a history export request, which takes the same
+// filters as a history page.
+func GetHistoryExport(param Params) (*HistoryExport, ErrCode) {
+	addr, ok := param.String("addr")
+	if !ok {
+		return nil, InvalidParams
+	}
+	if _, err := common.Uint168FromAddress(addr); err != nil {
+		return nil, InvalidParams
+	}
+	query, _, errCode := getTxHistoryQuery(param, addr)
+	if errCode != Success {
+		return nil, errCode
+	}
+	export := &HistoryExport{Address: addr, Format: ExportCSV}
+	if format, ok := param.String("format"); ok {
+		export.Format = format
+	}
+	switch export.Format {
+	case ExportCSV:
+		export.ContentType = "text/csv;charset=utf-8"
+		export.Write = func(w io.Writer) error { return exportTxHistoryCSV(w, query) }
+	case ExportJSONL:
+		export.ContentType = "application/x-ndjson;charset=utf-8"
+		export.Write = func(w io.Writer) error { return exportTxHistoryJSONL(w, query) }
+	default:
+		return nil, InvalidParams
+	}
+	return export, Success
+}
+
+func exportTxHistoryCSV(w io.Writer, query blockchain.TxHistoryQuery) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(txHistoryExportHeader); err != nil {
+		return err
+	}
+	err := blockchain.DefaultChainStoreEx.WalkTxHistory(query, func(txh *types.TransactionHistory) error {
+		return cw.Write(newTxHistoryExportRow(txh).record())
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportTxHistoryJSONL(w io.Writer, query blockchain.TxHistoryQuery) error {
+	enc := json.NewEncoder(w)
+	return blockchain.DefaultChainStoreEx.WalkTxHistory(query, func(txh *types.TransactionHistory) error {
+		return enc.Encode(newTxHistoryExportRow(txh))
+	})
+}
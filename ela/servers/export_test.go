@@ -0,0 +1,80 @@
+package servers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+)
+
+// exportChainStore serves the same rows to every history walk.
+type exportChainStore struct {
+	blockchain.IChainStoreExtend
+	rows []types.TransactionHistory
+}
+
+func (s *exportChainStore) WalkTxHistory(query blockchain.TxHistoryQuery,
+	fn func(txh *types.TransactionHistory) error) error {
+	for i := range s.rows {
+		if err := fn(&s.rows[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func testExportRows() []types.TransactionHistory {
+	return []types.TransactionHistory{
+		{Address: "EAddr", Txid: "01", Height: 5, CreateTime: 1500000000, Type: "income",
+			TxType: "TransferAsset", Value: 150000000, Memo: "rent, march", Inputs: []string{"EFrom"},
+			Outputs: []string{"EAddr", "EFrom"}},
+		{Address: "EAddr", Txid: "02", Height: 6, CreateTime: 1500000060, Type: "spend",
+			TxType: "TransferAsset", Value: 10, Fee: 100, Memo: "=HYPERLINK(\"http://x\")"},
+		{Address: "EAddr", Txid: "03", Height: 7, Type: "income", Memo: "@SUM(A1)"},
+	}
+}
+
+func Test_ExportTxHistoryCSV(t *testing.T) {
+	defer func(c blockchain.IChainStoreExtend) { blockchain.DefaultChainStoreEx = c }(blockchain.DefaultChainStoreEx)
+	blockchain.DefaultChainStoreEx = &exportChainStore{rows: testExportRows()}
+
+	var out bytes.Buffer
+	if err := exportTxHistoryCSV(&out, blockchain.TxHistoryQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	expect := strings.Join([]string{
+		"address,txid,height,time,type,txtype,value,fee,memo,inputs,outputs",
+		"EAddr,01,5,2017-07-14T02:40:00Z,income,TransferAsset,1.50000000,0.00000000,\"rent, march\",EFrom,EAddr EFrom",
+		"EAddr,02,6,2017-07-14T02:41:00Z,spend,TransferAsset,0.00000010,0.00000100,\"'=HYPERLINK(\"\"http://x\"\")\",,",
+		"EAddr,03,7,1970-01-01T00:00:00Z,income,,0.00000000,0.00000000,'@SUM(A1),,",
+		"",
+	}, "\n")
+	if out.String() != expect {
+		t.Errorf("expect csv\n%s\ngot\n%s", expect, out.String())
+	}
+}
+
+func Test_ExportTxHistoryJSONL(t *testing.T) {
+	defer func(c blockchain.IChainStoreExtend) { blockchain.DefaultChainStoreEx = c }(blockchain.DefaultChainStoreEx)
+	blockchain.DefaultChainStoreEx = &exportChainStore{rows: testExportRows()}
+
+	var out bytes.Buffer
+	if err := exportTxHistoryJSONL(&out, blockchain.TxHistoryQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, got %q", out.String())
+	}
+	var row TxHistoryExportRow
+	if err := json.Unmarshal([]byte(lines[1]), &row); err != nil {
+		t.Fatal(err)
+	}
+	// json is not read as a spreadsheet, the memo is kept as is
+	if row.Txid != "02" || row.Value != "0.00000010" || row.Memo != "=HYPERLINK(\"http://x\")" {
+		t.Errorf("unexpected row %+v", row)
+	}
+}
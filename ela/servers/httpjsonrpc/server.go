@@ -0,0 +1,108 @@
+package httpjsonrpc
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/servers"
+	"github.com/elastos/Elastos.ELA.Utility/http/jsonrpc"
+	"github.com/elastos/Elastos.ELA.Utility/http/util"
+	"github.com/elastos/Elastos.ELA/common/config"
+	"github.com/elastos/Elastos.ELA/common/log"
+	. "github.com/elastos/Elastos.ELA/errors"
+)
+
+// historyParams are the parameters of the history methods, in the order
+// they are taken positionally.
+var historyParams = []string{"addr", "pageSize", "pageNum", "cursor", "order",
+	"fromHeight", "toHeight", "type", "txtype", "fromTime", "toTime", "minValue", "unit"}
+
+// StartRPCServer serves the upstream methods along with the extended ones
+// on the json rpc port.
+func StartRPCServer() {
+	port := config.Parameters.HttpJsonPort
+	s := newJsonRpcServer(uint16(port))
+	err := http.ListenAndServe(":"+strconv.Itoa(port), restrictClients(s))
+	if err != nil {
+		log.Errorf("Start HttpJsonRpc server failed, %s", err.Error())
+	}
+}
+
+// restrictClients only serves local clients and the white listed ips of the
+// rpc configuration, as the upstream json rpc server does.
+func restrictClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !servers.AllowAdmin(r) {
+			log.Warnf("json rpc client %s is not allowed", r.RemoteAddr)
+			http.Error(w, "Client ip is not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newJsonRpcServer(port uint16) *jsonrpc.Server {
+	s := jsonrpc.NewServer(&jsonrpc.Config{ServePort: port})
+
+	s.RegisterAction("setloglevel", action(servers.SetLogLevel), "level")
+	s.RegisterAction("getinfo", action(servers.GetInfo))
+	s.RegisterAction("getblock", action(servers.GetBlockByHash), "blockhash", "verbosity")
+	s.RegisterAction("getcurrentheight", action(servers.GetBlockHeight))
+	s.RegisterAction("getblockhash", action(servers.GetBlockHash), "height")
+	s.RegisterAction("getconnectioncount", action(servers.GetConnectionCount))
+	s.RegisterAction("getrawmempool", action(servers.GetTransactionPool))
+	s.RegisterAction("getrawtransaction", action(servers.GetRawTransaction), "txid", "verbose")
+	s.RegisterAction("getneighbors", action(servers.GetNeighbors))
+	s.RegisterAction("getnodestate", action(servers.GetNodeState))
+	s.RegisterAction("sendrawtransaction", action(servers.SendRawTransaction), "data")
+	s.RegisterAction("getbestblockhash", action(servers.GetBestBlockHash))
+	s.RegisterAction("getblockcount", action(servers.GetBlockCount))
+	s.RegisterAction("getblockbyheight", action(servers.GetBlockByHeight), "height")
+	s.RegisterAction("getexistwithdrawtransactions", action(servers.GetExistWithdrawTransactions), "txs")
+	s.RegisterAction("listunspent", action(servers.ListUnspent), "addresses", "utxotype")
+	s.RegisterAction("getreceivedbyaddress", action(servers.GetReceivedByAddress), "address")
+	s.RegisterAction("getarbitratorgroupbyheight", action(servers.GetArbitratorGroupByHeight), "height")
+	s.RegisterAction("submitauxblock", action(servers.SubmitAuxBlock), "blockhash", "auxpow")
+	s.RegisterAction("createauxblock", action(servers.CreateAuxBlock), "paytoaddress")
+	s.RegisterAction("help", action(servers.AuxHelp))
+	s.RegisterAction("togglemining", action(servers.ToggleMining), "mining")
+	s.RegisterAction("discretemining", action(servers.DiscreteMining), "count")
+	s.RegisterAction("listproducers", action(servers.ListProducers), "start", "limit")
+	s.RegisterAction("producerstatus", action(servers.ProducerStatus), "publickey")
+	s.RegisterAction("votestatus", action(servers.VoteStatus), "address")
+	s.RegisterAction("getdepositcoin", action(servers.GetDepositCoin), "ownerpublickey")
+	s.RegisterAction("estimatesmartfee", action(servers.EstimateSmartFee), "confirmations")
+
+	// extended
+	s.RegisterAction("gethistory", action(servers.GetHistory), historyParams...)
+	s.RegisterAction("getpendinghistory", action(servers.GetPendingHistory), "addr", "unit")
+	s.RegisterAction("getwallethistory", action(servers.GetWalletHistory), "addresses", "unit",
+		"pageSize", "cursor", "order", "fromHeight", "toHeight")
+	s.RegisterAction("getwalletbalance", action(servers.GetWalletBalance), "addresses")
+	s.RegisterAction("getcrosschaindeposits", action(servers.GetCrossChainDeposits), "addr")
+	s.RegisterAction("getcrosschainwithdrawal", action(servers.GetCrossChainWithdrawal), "hash")
+	s.RegisterAction("getbalanceatheight", action(servers.GetBalanceAtHeight), "addr", "height")
+	s.RegisterAction("getbalanceattime", action(servers.GetBalanceAtTime), "addr", "time")
+	s.RegisterAction("getbalanceseries", action(servers.GetBalanceSeries), "addr", "fromHeight", "toHeight", "limit")
+	s.RegisterAction("getaddresssummary", action(servers.GetAddressSummary), "addr")
+	s.RegisterAction("getrichlist", action(servers.GetRichList), "offset", "limit")
+	s.RegisterAction("getrichlistrank", action(servers.GetRichListRank), "addr")
+	s.RegisterAction("getoutputspentby", action(servers.GetOutputSpentBy), "txid", "index")
+	s.RegisterAction("getindexstatus", action(servers.GetIndexStatus))
+	s.RegisterAction("getoutputcachestats", action(servers.GetOutputCacheStats))
+
+	return s
+}
+
+// action adapts a handler shared with the rest server, whose response
+// carries its error code, to the json rpc server.
+func action(handler func(servers.Params) map[string]interface{}) jsonrpc.Handler {
+	return func(params util.Params) (interface{}, error) {
+		resp := handler(servers.Params(params))
+		if errCode := resp["Error"].(ErrCode); errCode != Success {
+			return nil, util.NewError(int(errCode), fmt.Sprint(resp["Result"]))
+		}
+		return resp["Result"], nil
+	}
+}
@@ -0,0 +1,74 @@
+package httpjsonrpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/servers"
+	"github.com/elastos/Elastos.ELA.Utility/http/util"
+	"github.com/elastos/Elastos.ELA/common/config"
+	. "github.com/elastos/Elastos.ELA/errors"
+)
+
+func Test_ActionErrorCode(t *testing.T) {
+	failing := action(func(servers.Params) map[string]interface{} {
+		return servers.ResponsePack(InvalidParams, "invalid addr")
+	})
+	result, err := failing(util.Params{})
+	rpcErr, ok := err.(*util.Error)
+	if !ok || rpcErr.Code != int(InvalidParams) || rpcErr.Message != "invalid addr" || result != nil {
+		t.Errorf("expect error %d invalid addr, got %v %#v", InvalidParams, result, err)
+	}
+
+	var params servers.Params
+	succeeding := action(func(p servers.Params) map[string]interface{} {
+		params = p
+		return servers.ResponsePack(Success, "done")
+	})
+	result, err = succeeding(util.Params{"addr": "a"})
+	if err != nil || result != "done" {
+		t.Errorf("expect result done, got %v %v", result, err)
+	}
+	if params["addr"] != "a" {
+		t.Errorf("expect params passed to the handler, got %v", params)
+	}
+}
+
+func Test_RestrictClients(t *testing.T) {
+	whiteList := config.Parameters.RpcConfiguration.WhiteIPList
+	defer func() { config.Parameters.RpcConfiguration.WhiteIPList = whiteList }()
+	config.Parameters.RpcConfiguration.WhiteIPList = []string{"10.0.0.1"}
+
+	var served string
+	handler := restrictClients(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		served = string(body)
+	}))
+	tests := []struct {
+		remote string
+		body   string
+		allow  bool
+	}{
+		{"192.0.2.1:20336", `{"method":"togglemining","params":{"mining":true}}`, false},
+		{"192.0.2.1:20336", `{"method":"sendrawtransaction","params":["00"]}`, false},
+		{"192.0.2.1:20336", `{"method":"gethistory","params":{"addr":"a"}}`, false},
+		{"127.0.0.1:20336", `{"method":"togglemining","params":{"mining":true}}`, true},
+		{"10.0.0.1:20336", `{"method":"gethistory","params":{"addr":"a"}}`, true},
+	}
+	for _, test := range tests {
+		served = ""
+		r := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		r.RemoteAddr = test.remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if test.allow && (w.Code != http.StatusOK || served != test.body) {
+			t.Errorf("expect %s from %s served, got %d %q", test.body, test.remote, w.Code, served)
+		}
+		if !test.allow && (w.Code != http.StatusForbidden || served != "") {
+			t.Errorf("expect %s from %s rejected, got %d %q", test.body, test.remote, w.Code, served)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -36,10 +37,46 @@ const (
 	ApiRestart             = "/api/v1/restart"
 
 	//extended
-	ApiGetHistory = "/api/v1/history/:addr"
-	ApiSendRawTx  = "/api/v1/sendRawTx"
+	ApiGetHistory              = "/api/v1/history/:addr"
+	ApiGetPendingHistory       = "/api/v1/history/:addr/pending"
+	ApiExportHistory           = "/api/v1/history/:addr/export"
+	ApiSubscribe               = "/api/v1/ws"
+	ApiAddWebhook              = "/api/v1/webhooks"
+	ApiGetWebhooks             = "/api/v1/webhooks"
+	ApiRemoveWebhook           = "/api/v1/webhooks/remove"
+	ApiGetWebhookDeadLetters   = "/api/v1/webhooks/deadletters"
+	ApiSendRawTx               = "/api/v1/sendRawTx"
+	ApiGetCrossChainDeposits   = "/api/v1/crosschain/deposits/:addr"
+	ApiGetCrossChainWithdrawal = "/api/v1/crosschain/withdrawal/:hash"
+	ApiGetBalanceAtHeight      = "/api/v1/balance/:addr/at/:height"
+	ApiGetBalanceAtTime        = "/api/v1/balance/:addr/time/:time"
+	ApiGetBalanceSeries        = "/api/v1/balance/:addr/series"
+	ApiGetAddressSummary       = "/api/v1/address/:addr/summary"
+	ApiGetRichList             = "/api/v1/richlist"
+	ApiGetRichListRank         = "/api/v1/richlist/:addr"
+	ApiGetOutputSpentBy        = "/api/v1/outpoint/:txid/:index/spentby"
+	ApiGetIndexStatus          = "/api/v1/index/status"
+	ApiGetOutputCacheStats     = "/api/v1/index/cache"
+	ApiVerifyIndex             = "/api/v1/index/verify"
+	ApiGetIndexVerification    = "/api/v1/index/verify"
+	ApiGetIndexQuarantine      = "/api/v1/index/quarantine"
+	ApiRetryIndexQuarantine    = "/api/v1/index/quarantine/retry"
+	ApiGetWalletHistory        = "/api/v1/wallet/history"
+	ApiGetWalletBalance        = "/api/v1/wallet/balance"
 )
 
+// adminApis are only served to local clients and to the white listed ips
+// of the rpc configuration. They are keyed by path, listing webhooks shares
+// the path of adding one.
+var adminApis = map[string]bool{
+	ApiAddWebhook:            true,
+	ApiRemoveWebhook:         true,
+	ApiGetWebhookDeadLetters: true,
+	ApiVerifyIndex:           true,
+	ApiGetIndexQuarantine:    true,
+	ApiRetryIndexQuarantine:  true,
+}
+
 type Action struct {
 	sync.RWMutex
 	name    string
@@ -52,6 +89,7 @@ type restServer struct {
 	server   *http.Server
 	postMap  map[string]Action
 	getMap   map[string]Action
+	hub      *wsHub
 }
 
 type ApiServer interface {
@@ -67,6 +105,7 @@ func StartServer() {
 func InitRestServer() ApiServer {
 	rt := &restServer{}
 	rt.router = &Router{}
+	rt.hub = newWsHub()
 	rt.initializeMethod()
 	rt.initGetHandler()
 	rt.initPostHandler()
@@ -119,13 +158,35 @@ func (rt *restServer) initializeMethod() {
 		ApiRestart:             {name: "restart", handler: rt.Restart},
 
 		// extended
-		ApiGetHistory: {name: "gethistory", handler: servers.GetHistory},
+		ApiGetHistory:              {name: "gethistory", handler: servers.GetHistory},
+		ApiGetCrossChainDeposits:   {name: "getcrosschaindeposits", handler: servers.GetCrossChainDeposits},
+		ApiGetCrossChainWithdrawal: {name: "getcrosschainwithdrawal", handler: servers.GetCrossChainWithdrawal},
+		ApiGetBalanceAtHeight:      {name: "getbalanceatheight", handler: servers.GetBalanceAtHeight},
+		ApiGetBalanceAtTime:        {name: "getbalanceattime", handler: servers.GetBalanceAtTime},
+		ApiGetBalanceSeries:        {name: "getbalanceseries", handler: servers.GetBalanceSeries},
+		ApiGetAddressSummary:       {name: "getaddresssummary", handler: servers.GetAddressSummary},
+		ApiGetPendingHistory:       {name: "getpendinghistory", handler: servers.GetPendingHistory},
+		ApiGetWebhooks:             {name: "getwebhooks", handler: servers.GetWebhooks},
+		ApiGetWebhookDeadLetters:   {name: "getwebhookdeadletters", handler: servers.GetWebhookDeadLetters},
+		ApiGetRichList:             {name: "getrichlist", handler: servers.GetRichList},
+		ApiGetRichListRank:         {name: "getrichlistrank", handler: servers.GetRichListRank},
+		ApiGetOutputSpentBy:        {name: "getoutputspentby", handler: servers.GetOutputSpentBy},
+		ApiGetIndexStatus:          {name: "getindexstatus", handler: servers.GetIndexStatus},
+		ApiGetOutputCacheStats:     {name: "getoutputcachestats", handler: servers.GetOutputCacheStats},
+		ApiGetIndexVerification:    {name: "getindexverification", handler: servers.GetIndexVerification},
+		ApiGetIndexQuarantine:      {name: "getindexquarantine", handler: servers.GetIndexQuarantine},
 	}
 
 	postMethodMap := map[string]Action{
 		ApiSendRawTransaction: {name: "sendrawtransaction", handler: servers.SendRawTransaction},
 		// extended
-		ApiSendRawTx: {name: "sendrawtx", handler: servers.SendRawTransaction},
+		ApiSendRawTx:            {name: "sendrawtx", handler: servers.SendRawTransaction},
+		ApiGetWalletHistory:     {name: "getwallethistory", handler: servers.GetWalletHistory},
+		ApiGetWalletBalance:     {name: "getwalletbalance", handler: servers.GetWalletBalance},
+		ApiAddWebhook:           {name: "addwebhook", handler: servers.AddWebhook},
+		ApiRemoveWebhook:        {name: "removewebhook", handler: servers.RemoveWebhook},
+		ApiVerifyIndex:          {name: "verifyindex", handler: servers.VerifyIndex},
+		ApiRetryIndexQuarantine: {name: "retryindexquarantine", handler: servers.RetryIndexQuarantine},
 	}
 	rt.postMap = postMethodMap
 	rt.getMap = getMethodMap
@@ -153,8 +214,26 @@ func (rt *restServer) getPath(url string) string {
 		return ApiGetUTXOByAsset
 	} else if strings.Contains(url, strings.TrimRight(ApiGetAsset, ":hash")) {
 		return ApiGetAsset
+	} else if matchPath(url, ApiGetPendingHistory) {
+		return ApiGetPendingHistory
 	} else if strings.Contains(url, strings.TrimRight(ApiGetHistory, ":addr")) {
 		return ApiGetHistory
+	} else if strings.Contains(url, strings.TrimRight(ApiGetCrossChainDeposits, ":addr")) {
+		return ApiGetCrossChainDeposits
+	} else if strings.Contains(url, strings.TrimRight(ApiGetCrossChainWithdrawal, ":hash")) {
+		return ApiGetCrossChainWithdrawal
+	} else if matchPath(url, ApiGetBalanceAtHeight) {
+		return ApiGetBalanceAtHeight
+	} else if matchPath(url, ApiGetBalanceAtTime) {
+		return ApiGetBalanceAtTime
+	} else if matchPath(url, ApiGetBalanceSeries) {
+		return ApiGetBalanceSeries
+	} else if matchPath(url, ApiGetAddressSummary) {
+		return ApiGetAddressSummary
+	} else if matchPath(url, ApiGetRichListRank) {
+		return ApiGetRichListRank
+	} else if matchPath(url, ApiGetOutputSpentBy) {
+		return ApiGetOutputSpentBy
 	}
 	return url
 }
@@ -206,7 +285,51 @@ func (rt *restServer) getParams(r *http.Request, url string, req map[string]inte
 	case ApiSendRawTransaction:
 
 	case ApiGetHistory:
+		req = getQueryParams(r, req)
+		req["addr"] = getParam(r, "addr")
+	case ApiGetPendingHistory:
+		req = getQueryParams(r, req)
+		req["addr"] = getParam(r, "addr")
+	case ApiGetCrossChainDeposits:
 		req["addr"] = getParam(r, "addr")
+	case ApiGetCrossChainWithdrawal:
+		req["hash"] = getParam(r, "hash")
+	case ApiGetBalanceAtHeight:
+		req["addr"] = getParam(r, "addr")
+		req["height"] = getParam(r, "height")
+	case ApiGetBalanceAtTime:
+		req["addr"] = getParam(r, "addr")
+		req["time"] = getParam(r, "time")
+	case ApiGetBalanceSeries:
+		req = getQueryParams(r, req)
+		req["addr"] = getParam(r, "addr")
+	case ApiGetAddressSummary:
+		req["addr"] = getParam(r, "addr")
+	case ApiGetRichList:
+		req = getQueryParams(r, req)
+	case ApiGetRichListRank:
+		req["addr"] = getParam(r, "addr")
+	case ApiGetOutputSpentBy:
+		req["txid"] = getParam(r, "txid")
+		req["index"] = getParam(r, "index")
+	}
+	return req
+}
+
+// matchPath reports whether the url fits an api path with parameters in
+// the middle, which a prefix match cannot tell apart.
+func matchPath(url, api string) bool {
+	pattern := "^" + paramsRegexp.ReplaceAllString(api, `\w+`) + "$"
+	match, _ := regexp.MatchString(pattern, url)
+	return match
+}
+
+// getQueryParams copies the url query parameters into the request params.
+func getQueryParams(r *http.Request, req map[string]interface{}) map[string]interface{} {
+	for k, v := range r.URL.Query() {
+		if len(v) > 0 {
+			req[k] = v[0]
+		}
 	}
 	return req
 }
@@ -221,7 +344,9 @@ func (rt *restServer) initGetHandler() {
 
 			url := rt.getPath(r.URL.Path)
 
-			if h, ok := rt.getMap[url]; ok {
+			if adminApis[url] && !servers.AllowAdmin(r) {
+				resp = servers.ResponsePack(InvalidMethod, "")
+			} else if h, ok := rt.getMap[url]; ok {
 				req = rt.getParams(r, url, req)
 				resp = h.handler(req)
 			} else {
@@ -230,6 +355,27 @@ func (rt *restServer) initGetHandler() {
 			rt.response(w, resp)
 		})
 	}
+	rt.router.Get(ApiExportHistory, rt.exportHistory)
+	rt.router.Get(ApiSubscribe, rt.hub.serve)
+}
+
+// exportHistory streams the history of an address as a file instead of a
+// json response, so it is routed on its own.
+func (rt *restServer) exportHistory(w http.ResponseWriter, r *http.Request) {
+	req := getQueryParams(r, make(map[string]interface{}))
+	req["addr"] = getParam(r, "addr")
+	export, errCode := servers.GetHistoryExport(req)
+	if errCode != Success {
+		rt.response(w, servers.ResponsePack(errCode, ""))
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("content-type", export.ContentType)
+	w.Header().Set("Content-Disposition",
+		"attachment; filename=history-"+export.Address+"."+export.Format)
+	if err := export.Write(w); err != nil {
+		log.Error("export history: ", err)
+	}
 }
 
 func (rt *restServer) initPostHandler() {
@@ -243,7 +389,9 @@ func (rt *restServer) initPostHandler() {
 			var resp map[string]interface{}
 
 			url := rt.getPath(r.URL.Path)
-			if h, ok := rt.postMap[url]; ok {
+			if adminApis[url] && !servers.AllowAdmin(r) {
+				resp = servers.ResponsePack(InvalidMethod, "")
+			} else if h, ok := rt.postMap[url]; ok {
 				if err := json.Unmarshal(body, &req); err == nil {
 					req = rt.getParams(r, url, req)
 					resp = h.handler(req)
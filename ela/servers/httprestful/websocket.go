@@ -0,0 +1,169 @@
+package httprestful
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/servers"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/common/log"
+	. "github.com/elastos/Elastos.ELA/errors"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsSendQueue is the number of messages queued for a client before it
+	// is considered too slow and dropped.
+	wsSendQueue = 64
+	// wsWriteWait is the time allowed to write a message to a client.
+	wsWriteWait = 10 * time.Second
+	// wsMaxAddresses is the largest number of addresses a client may
+	// subscribe to.
+	wsMaxAddresses = 1000
+
+	wsActionSubscribe   = "subscribe"
+	wsActionUnsubscribe = "unsubscribe"
+	wsActionHistory     = "history"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// wsRequest subscribes a client to, or unsubscribes it from, the history of
+// addresses.
+type wsRequest struct {
+	Action    string   `json:"action"`
+	Addresses []string `json:"addresses"`
+}
+
+// wsClient is a websocket connection and the addresses it subscribed to.
+type wsClient struct {
+	conn      *websocket.Conn
+	send      chan map[string]interface{}
+	addresses map[string]struct{}
+}
+
+// wsHub pushes new history rows to the clients subscribed to their
+// addresses, confirmed rows as their block is indexed and pending rows as
+// the pool watcher of the store sees their transaction.
+type wsHub struct {
+	sync.RWMutex
+	clients map[*wsClient]struct{}
+}
+
+func newWsHub() *wsHub {
+	h := &wsHub{clients: make(map[*wsClient]struct{})}
+	blockchain.DefaultChainStoreEx.RegisterHistoryListener(h)
+	return h
+}
+
+// OnTxHistory queues the rows of the subscribed addresses for every client.
+// A client too slow to keep up is disconnected rather than block indexing.
+func (h *wsHub) OnTxHistory(txhs []types.TransactionHistory) {
+	h.RLock()
+	defer h.RUnlock()
+	for client := range h.clients {
+		var rows []types.TransactionHistory
+		for _, txh := range txhs {
+			if _, ok := client.addresses[txh.Address]; ok {
+				rows = append(rows, txh)
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		msg := servers.ResponsePack(Success, rows)
+		msg["Action"] = wsActionHistory
+		select {
+		case client.send <- msg:
+		default:
+			client.conn.Close()
+		}
+	}
+}
+
+func (h *wsHub) serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("websocket upgrade: ", err)
+		return
+	}
+	client := &wsClient{
+		conn:      conn,
+		send:      make(chan map[string]interface{}, wsSendQueue),
+		addresses: make(map[string]struct{}),
+	}
+	h.Lock()
+	h.clients[client] = struct{}{}
+	h.Unlock()
+
+	go h.write(client)
+	h.read(client)
+
+	h.Lock()
+	delete(h.clients, client)
+	h.Unlock()
+	close(client.send)
+}
+
+// read handles the requests of a client until its connection is closed.
+func (h *wsHub) read(client *wsClient) {
+	defer client.conn.Close()
+	for {
+		var req wsRequest
+		if err := client.conn.ReadJSON(&req); err != nil {
+			return
+		}
+		resp := h.handle(client, &req)
+		resp["Action"] = req.Action
+		select {
+		case client.send <- resp:
+		default:
+			return
+		}
+	}
+}
+
+func (h *wsHub) handle(client *wsClient, req *wsRequest) map[string]interface{} {
+	for _, addr := range req.Addresses {
+		if _, err := common.Uint168FromAddress(addr); err != nil {
+			return servers.ResponsePack(InvalidParams, "invalid address "+addr)
+		}
+	}
+	h.Lock()
+	defer h.Unlock()
+	switch req.Action {
+	case wsActionSubscribe:
+		if len(client.addresses)+len(req.Addresses) > wsMaxAddresses {
+			return servers.ResponsePack(InvalidParams, "too many addresses")
+		}
+		for _, addr := range req.Addresses {
+			client.addresses[addr] = struct{}{}
+		}
+	case wsActionUnsubscribe:
+		for _, addr := range req.Addresses {
+			delete(client.addresses, addr)
+		}
+	default:
+		return servers.ResponsePack(InvalidMethod, "")
+	}
+	return servers.ResponsePack(Success, len(client.addresses))
+}
+
+// write sends the queued messages of a client until its queue is closed.
+func (h *wsHub) write(client *wsClient) {
+	defer client.conn.Close()
+	for msg := range client.send {
+		msg["Desc"] = ErrMap[msg["Error"].(ErrCode)]
+		client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := client.conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
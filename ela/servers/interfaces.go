@@ -7,10 +7,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
 	"math"
 	"time"
 
+	common2 "github.com/elastos/Elastos.ELA.Elephant.Node/common"
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/pow"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/webhook"
 	aux "github.com/elastos/Elastos.ELA/auxpow"
 	chain "github.com/elastos/Elastos.ELA/blockchain"
 	"github.com/elastos/Elastos.ELA/common"
@@ -28,6 +31,16 @@ import (
 const (
 	AUXBLOCK_GENERATED_INTERVAL_SECONDS = 5
 
+	// MaxHistoryPageSize is the largest page of history served at once.
+	MaxHistoryPageSize = 1000
+	// MaxBalanceSeriesPoints is the largest balance series served at once.
+	MaxBalanceSeriesPoints = 1000
+	// MaxRichListSize is the largest page of the rich list served at once.
+	MaxRichListSize = 1000
+	// MaxWalletAddresses is the largest number of addresses a wallet query
+	// accepts.
+	MaxWalletAddresses = 200
+
 	MixedUTXO  utxoType = 0x00
 	VoteUTXO   utxoType = 0x01
 	NormalUTXO utxoType = 0x02
@@ -70,6 +83,9 @@ func GetTransactionInfo(header *Header, tx *Transaction) *TransactionInfo {
 		outputs[i].OutputType = uint32(v.OutputType)
 		outputs[i].OutputPayload = getOutputPayloadInfo(v.OutputPayload)
 	}
+	if header != nil {
+		setOutputsSpent(tx.Hash(), outputs)
+	}
 
 	attributes := make([]AttributeInfo, len(tx.Attributes))
 	for i, v := range tx.Attributes {
@@ -1156,6 +1172,9 @@ func EstimateSmartFee(param Params) map[string]interface{} {
 	return ResponsePack(Success, GetFeeRate(count, int(confirm))*FeeRate)
 }
 
+// GetHistory returns the transaction history of an address. Without any of
+// the paging or filter parameters the whole history is returned as before,
+// otherwise a page with the total count and the cursor of the next page.
 func GetHistory(param Params) map[string]interface{} {
 	addr, ok := param.String("addr")
 	if !ok {
@@ -1165,10 +1184,724 @@ func GetHistory(param Params) map[string]interface{} {
 	if err != nil {
 		return ResponsePack(InvalidParams, "")
 	}
-	txhs := blockchain.DefaultChainStoreEx.GetTxHistory(addr)
+	query, paged, errCode := getTxHistoryQuery(param, addr)
+	if errCode != Success {
+		return ResponsePack(errCode, "")
+	}
+	inEla, errCode := getUnit(param)
+	if errCode != Success {
+		return ResponsePack(errCode, "")
+	}
+	if !paged {
+		txhs := blockchain.DefaultChainStoreEx.GetTxHistory(addr)
+		if inEla {
+			return ResponsePack(Success, getTxHistoryInfos(txhs))
+		}
+		return ResponsePack(Success, txhs)
+	}
+	page, err := blockchain.DefaultChainStoreEx.GetTxHistoryPage(query)
+	if err != nil {
+		return ResponsePack(InvalidParams, err.Error())
+	}
+	if inEla {
+		return ResponsePack(Success, TxHistoryPageInfo{
+			History:    getTxHistoryInfos(page.History),
+			Total:      page.Total,
+			NextCursor: page.NextCursor,
+		})
+	}
+	return ResponsePack(Success, page)
+}
+
+// GetPendingHistory returns the rows of the transactions of an address that
+// are still waiting in the transaction pool.
+func GetPendingHistory(param Params) map[string]interface{} {
+	addr, ok := param.String("addr")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	if _, err := common.Uint168FromAddress(addr); err != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	inEla, errCode := getUnit(param)
+	if errCode != Success {
+		return ResponsePack(errCode, "")
+	}
+	txhs := blockchain.DefaultChainStoreEx.GetPendingTxHistory(addr)
+	if inEla {
+		return ResponsePack(Success, getTxHistoryInfos(txhs))
+	}
 	return ResponsePack(Success, txhs)
 }
 
+// GetWalletHistory returns the merged history of the addresses of a wallet.
+// Like the history of an address, it is paged when any of the paging
+// parameters is given, and returned whole otherwise.
+func GetWalletHistory(param Params) map[string]interface{} {
+	addrs, errCode := getWalletAddresses(param)
+	if errCode != Success {
+		return ResponsePack(errCode, "")
+	}
+	query, paged, errCode := getWalletTxHistoryQuery(param, addrs)
+	if errCode != Success {
+		return ResponsePack(errCode, "")
+	}
+	inEla, errCode := getUnit(param)
+	if errCode != Success {
+		return ResponsePack(errCode, "")
+	}
+	page, err := blockchain.DefaultChainStoreEx.GetWalletTxHistoryPage(query)
+	if err != nil {
+		return ResponsePack(InvalidParams, err.Error())
+	}
+	if !inEla {
+		if !paged {
+			return ResponsePack(Success, page.History)
+		}
+		return ResponsePack(Success, page)
+	}
+	infos := make([]WalletTxHistoryInfo, 0, len(page.History))
+	for i := range page.History {
+		infos = append(infos, WalletTxHistoryInfo{
+			TxHistoryInfo: getTxHistoryInfo(&page.History[i].TransactionHistory),
+			Addresses:     page.History[i].Addresses,
+		})
+	}
+	if !paged {
+		return ResponsePack(Success, infos)
+	}
+	return ResponsePack(Success, WalletTxHistoryPageInfo{History: infos, NextCursor: page.NextCursor})
+}
+
+// getWalletTxHistoryQuery reads the paging parameters of a wallet history
+// request, and reports whether any was given.
+func getWalletTxHistoryQuery(param Params, addrs []string) (blockchain.WalletTxHistoryQuery, bool, ErrCode) {
+	query := blockchain.NewWalletTxHistoryQuery(addrs)
+	paged := false
+	if _, ok := param["pageSize"]; ok {
+		pageSize, ok := param.Uint("pageSize")
+		if !ok || pageSize == 0 || pageSize > MaxHistoryPageSize {
+			return query, paged, InvalidParams
+		}
+		query.PageSize = pageSize
+		paged = true
+	}
+	if cursor, ok := param.String("cursor"); ok && cursor != "" {
+		query.Cursor = cursor
+		paged = true
+	}
+	if order, ok := param.String("order"); ok {
+		switch order {
+		case "asc":
+		case "desc":
+			query.Descending = true
+		default:
+			return query, paged, InvalidParams
+		}
+		paged = true
+	}
+	if _, ok := param["fromHeight"]; ok {
+		from, ok := param.Uint("fromHeight")
+		if !ok {
+			return query, paged, InvalidParams
+		}
+		query.FromHeight = from
+		paged = true
+	}
+	if _, ok := param["toHeight"]; ok {
+		to, ok := param.Uint("toHeight")
+		if !ok {
+			return query, paged, InvalidParams
+		}
+		query.ToHeight = to
+		paged = true
+	}
+	return query, paged, Success
+}
+
+// GetWalletBalance returns the balance of every address of a wallet and
+// their sum.
+func GetWalletBalance(param Params) map[string]interface{} {
+	addrs, errCode := getWalletAddresses(param)
+	if errCode != Success {
+		return ResponsePack(errCode, "")
+	}
+	var total common.Fixed64
+	balances := make([]AddressBalanceInfo, 0, len(addrs))
+	for _, addr := range addrs {
+		programHash, _ := common.Uint168FromAddress(addr)
+		unspends, err := blockchain.DefaultChainStoreEx.GetUnspentsFromProgramHash(*programHash)
+		if err != nil {
+			return ResponsePack(InternalError, err.Error())
+		}
+		var balance common.Fixed64
+		for _, u := range unspends {
+			for _, v := range u {
+				balance += v.Value
+			}
+		}
+		total += balance
+		balances = append(balances, AddressBalanceInfo{Address: addr, Balance: balance.String()})
+	}
+	return ResponsePack(Success, WalletBalanceInfo{Balance: total.String(), Addresses: balances})
+}
+
+// getWalletAddresses reads the addresses of a wallet request, without
+// duplicates.
+func getWalletAddresses(param Params) ([]string, ErrCode) {
+	return getAddresses(param, MaxWalletAddresses)
+}
+
+// getAddresses reads at most max addresses of a request, without
+// duplicates.
+func getAddresses(param Params, max int) ([]string, ErrCode) {
+	addrs, ok := param.ArrayString("addresses")
+	if !ok || len(addrs) == 0 || len(addrs) > max {
+		return nil, InvalidParams
+	}
+	for _, addr := range addrs {
+		if _, err := common.Uint168FromAddress(addr); err != nil {
+			return nil, InvalidParams
+		}
+	}
+	return common2.NewStringSet(addrs...).Slice(), Success
+}
+
+// getUnit reads the unit amounts of history rows are given in, and reports
+// whether it is ELA. Rows are in sela unless unit=ela is asked for.
+func getUnit(param Params) (bool, ErrCode) {
+	unit, ok := param.String("unit")
+	if !ok {
+		return false, Success
+	}
+	switch unit {
+	case "ela":
+		return true, Success
+	case "sela":
+		return false, Success
+	}
+	return false, InvalidParams
+}
+
+func getTxHistoryInfos(txhs []types.TransactionHistory) []TxHistoryInfo {
+	infos := make([]TxHistoryInfo, 0, len(txhs))
+	for i := range txhs {
+		infos = append(infos, getTxHistoryInfo(&txhs[i]))
+	}
+	return infos
+}
+
+func getTxHistoryInfo(txh *types.TransactionHistory) TxHistoryInfo {
+	var crossChainAmounts []string
+	for _, amount := range txh.CrossChainAmounts {
+		crossChainAmounts = append(crossChainAmounts, common.Fixed64(amount).String())
+	}
+	return TxHistoryInfo{
+		Address:             txh.Address,
+		Txid:                txh.Txid,
+		Type:                txh.Type,
+		Value:               common.Fixed64(txh.Value).String(),
+		CreateTime:          txh.CreateTime,
+		Height:              txh.Height,
+		Fee:                 common.Fixed64(txh.Fee).String(),
+		Inputs:              txh.Inputs,
+		Outputs:             txh.Outputs,
+		TxType:              txh.TxType,
+		Memo:                txh.Memo,
+		CrossChainAddresses: txh.CrossChainAddresses,
+		CrossChainAmounts:   crossChainAmounts,
+		SideChainTxids:      txh.SideChainTxids,
+		Votes:               txh.Votes,
+		ProducerOwnerKey:    txh.ProducerOwnerKey,
+		DepositAmount:       common.Fixed64(txh.DepositAmount).String(),
+		Status:              txh.Status,
+	}
+}
+
+// getTxHistoryQuery reads the paging and filter parameters of a history
+// request, and reports whether any of them was given. minValue is in sela.
+func getTxHistoryQuery(param Params, addr string) (blockchain.TxHistoryQuery, bool, ErrCode) {
+	query := blockchain.NewTxHistoryQuery(addr)
+	paged := false
+	if _, ok := param["pageSize"]; ok {
+		pageSize, ok := param.Uint("pageSize")
+		if !ok || pageSize == 0 || pageSize > MaxHistoryPageSize {
+			return query, paged, InvalidParams
+		}
+		query.PageSize = pageSize
+		paged = true
+	}
+	if _, ok := param["pageNum"]; ok {
+		pageNum, ok := param.Uint("pageNum")
+		if !ok || pageNum == 0 || query.PageSize == 0 {
+			return query, paged, InvalidParams
+		}
+		query.PageNum = pageNum
+		paged = true
+	}
+	if cursor, ok := param.String("cursor"); ok && cursor != "" {
+		query.Cursor = cursor
+		paged = true
+	}
+	if order, ok := param.String("order"); ok {
+		switch order {
+		case "asc":
+		case "desc":
+			query.Descending = true
+		default:
+			return query, paged, InvalidParams
+		}
+		paged = true
+	}
+	if _, ok := param["fromHeight"]; ok {
+		from, ok := param.Uint("fromHeight")
+		if !ok {
+			return query, paged, InvalidParams
+		}
+		query.FromHeight = from
+		paged = true
+	}
+	if _, ok := param["toHeight"]; ok {
+		to, ok := param.Uint("toHeight")
+		if !ok {
+			return query, paged, InvalidParams
+		}
+		query.ToHeight = to
+		paged = true
+	}
+	if txType, ok := param.String("type"); ok {
+		query.Type = txType
+		paged = true
+	}
+	if txType, ok := param.String("txtype"); ok {
+		query.TxType = txType
+		paged = true
+	}
+	if _, ok := param["fromTime"]; ok {
+		from, ok := param.Uint("fromTime")
+		if !ok {
+			return query, paged, InvalidParams
+		}
+		query.FromTime = uint64(from)
+		paged = true
+	}
+	if _, ok := param["toTime"]; ok {
+		to, ok := param.Uint("toTime")
+		if !ok {
+			return query, paged, InvalidParams
+		}
+		query.ToTime = uint64(to)
+		paged = true
+	}
+	if _, ok := param["minValue"]; ok {
+		value, ok := param.Int("minValue")
+		if !ok || value < 0 {
+			return query, paged, InvalidParams
+		}
+		query.MinValue = uint64(value)
+		paged = true
+	}
+	return query, paged, Success
+}
+
+// GetCrossChainDeposits returns the deposits made from the main chain to a
+// side chain address.
+func GetCrossChainDeposits(param Params) map[string]interface{} {
+	addr, ok := param.String("addr")
+	if !ok || addr == "" {
+		return ResponsePack(InvalidParams, "")
+	}
+	records, err := blockchain.DefaultChainStoreEx.GetCrossChainDeposits(addr)
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	return ResponsePack(Success, records)
+}
+
+// GetCrossChainWithdrawal returns the main chain transaction that paid out a
+// side chain withdrawal.
+func GetCrossChainWithdrawal(param Params) map[string]interface{} {
+	hash, ok := param.String("hash")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	record, err := blockchain.DefaultChainStoreEx.GetCrossChainWithdrawal(hash)
+	if err != nil {
+		return ResponsePack(UnknownTransaction, "")
+	}
+	return ResponsePack(Success, record)
+}
+
+// GetBalanceAtHeight returns the balance of an address after the block at
+// the given height.
+func GetBalanceAtHeight(param Params) map[string]interface{} {
+	addr, ok := param.String("addr")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	if _, err := common.Uint168FromAddress(addr); err != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	height, ok := param.Uint("height")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	snapshot, found, err := blockchain.DefaultChainStoreEx.GetBalanceAt(addr, height)
+	if err != nil {
+		return ResponsePack(InvalidParams, err.Error())
+	}
+	info := getBalanceAtInfo(addr, snapshot, found)
+	info.Quarantined = blockchain.DefaultChainStoreEx.QuarantinedHeights(height)
+	return ResponsePack(Success, info)
+}
+
+// GetBalanceAtTime returns the balance of an address after the last block
+// created at or before the given unix time.
+func GetBalanceAtTime(param Params) map[string]interface{} {
+	addr, ok := param.String("addr")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	if _, err := common.Uint168FromAddress(addr); err != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	time, ok := param.Uint("time")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	snapshot, found, err := blockchain.DefaultChainStoreEx.GetBalanceAtTime(addr, uint64(time))
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	info := getBalanceAtInfo(addr, snapshot, found)
+	info.Quarantined = blockchain.DefaultChainStoreEx.QuarantinedHeights(math.MaxUint32)
+	return ResponsePack(Success, info)
+}
+
+// GetBalanceSeries returns the balance of an address at fromHeight followed
+// by every change up to toHeight.
+func GetBalanceSeries(param Params) map[string]interface{} {
+	addr, ok := param.String("addr")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	if _, err := common.Uint168FromAddress(addr); err != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	var from uint32
+	to := uint32(math.MaxUint32)
+	limit := uint32(MaxBalanceSeriesPoints)
+	if _, ok := param["fromHeight"]; ok {
+		if from, ok = param.Uint("fromHeight"); !ok {
+			return ResponsePack(InvalidParams, "")
+		}
+	}
+	if _, ok := param["toHeight"]; ok {
+		if to, ok = param.Uint("toHeight"); !ok {
+			return ResponsePack(InvalidParams, "")
+		}
+	}
+	if _, ok := param["limit"]; ok {
+		if limit, ok = param.Uint("limit"); !ok || limit == 0 || limit > MaxBalanceSeriesPoints {
+			return ResponsePack(InvalidParams, "")
+		}
+	}
+	if from > to {
+		return ResponsePack(InvalidParams, "")
+	}
+	series, err := blockchain.DefaultChainStoreEx.GetBalanceSeries(addr, from, to, limit)
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	quarantined := blockchain.DefaultChainStoreEx.QuarantinedHeights(to)
+	points := make([]BalanceSnapshotInfo, 0, len(series))
+	for _, snapshot := range series {
+		point := getBalanceSnapshotInfo(&snapshot)
+		point.Quarantined = quarantinedUpTo(quarantined, snapshot.Height)
+		points = append(points, point)
+	}
+	return ResponsePack(Success, points)
+}
+
+// GetAddressSummary returns the totals of an address without reading its
+// history.
+func GetAddressSummary(param Params) map[string]interface{} {
+	addr, ok := param.String("addr")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	if _, err := common.Uint168FromAddress(addr); err != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	summary, found, err := blockchain.DefaultChainStoreEx.GetAddressSummary(addr)
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	if !found {
+		summary = new(blockchain.AddressSummary)
+	}
+	return ResponsePack(Success, AddressSummaryInfo{
+		Address:     addr,
+		Received:    common.Fixed64(summary.Received).String(),
+		Sent:        common.Fixed64(summary.Sent).String(),
+		Fees:        common.Fixed64(summary.Fees).String(),
+		TxCount:     summary.TxCount,
+		FirstHeight: summary.FirstHeight,
+		FirstTime:   summary.FirstTime,
+		LastHeight:  summary.LastHeight,
+		LastTime:    summary.LastTime,
+		Quarantined: blockchain.DefaultChainStoreEx.QuarantinedHeights(math.MaxUint32),
+	})
+}
+
+// GetRichList returns a page of the addresses holding the most ELA, along
+// with the number of addresses holding any.
+func GetRichList(param Params) map[string]interface{} {
+	var offset uint32
+	limit := uint32(100)
+	if _, ok := param["offset"]; ok {
+		if offset, ok = param.Uint("offset"); !ok {
+			return ResponsePack(InvalidParams, "")
+		}
+	}
+	if _, ok := param["limit"]; ok {
+		if limit, ok = param.Uint("limit"); !ok || limit == 0 || limit > MaxRichListSize {
+			return ResponsePack(InvalidParams, "")
+		}
+	}
+	entries, holders, err := blockchain.DefaultChainStoreEx.GetRichList(uint64(offset), uint64(limit))
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	list := make([]RichListEntryInfo, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, getRichListEntryInfo(&entry))
+	}
+	return ResponsePack(Success, RichListInfo{
+		Holders:     holders,
+		Entries:     list,
+		Quarantined: blockchain.DefaultChainStoreEx.QuarantinedHeights(math.MaxUint32),
+	})
+}
+
+// GetRichListRank returns the rank of an address in the rich list, rank 0
+// for an address holding nothing.
+func GetRichListRank(param Params) map[string]interface{} {
+	addr, ok := param.String("addr")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	if _, err := common.Uint168FromAddress(addr); err != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	entry, found, err := blockchain.DefaultChainStoreEx.GetRichListRank(addr)
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	if !found {
+		entry = &blockchain.RichListEntry{Address: addr}
+	}
+	info := getRichListEntryInfo(entry)
+	info.Quarantined = blockchain.DefaultChainStoreEx.QuarantinedHeights(math.MaxUint32)
+	return ResponsePack(Success, info)
+}
+
+func getRichListEntryInfo(entry *blockchain.RichListEntry) RichListEntryInfo {
+	return RichListEntryInfo{
+		Rank:    entry.Rank,
+		Address: entry.Address,
+		Balance: common.Fixed64(entry.Balance).String(),
+	}
+}
+
+// setOutputsSpent marks the outputs of a confirmed transaction spent by
+// indexed blocks with the transaction spending them. An output whose entry
+// cannot be read is left unmarked and the error logged.
+func setOutputsSpent(txid common.Uint256, outputs []OutputInfo) {
+	for i := range outputs {
+		spent, ok, err := blockchain.DefaultChainStoreEx.GetSpentBy(txid, uint16(i))
+		if err != nil {
+			log.Warnf("read spent output %s:%d: %s", ToReversedString(txid), i, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		outputs[i].Spent = true
+		outputs[i].SpentBy = ToReversedString(spent.Txid)
+	}
+}
+
+// GetOutputSpentBy returns the input spending an output, or null when the
+// output is not spent by an indexed block.
+func GetOutputSpentBy(param Params) map[string]interface{} {
+	str, ok := param.String("txid")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	hex, err := FromReversedString(str)
+	if err != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	var txid common.Uint256
+	if err := txid.Deserialize(bytes.NewReader(hex)); err != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	index, ok := param.Uint("index")
+	if !ok || index > math.MaxUint16 {
+		return ResponsePack(InvalidParams, "")
+	}
+	spent, found, err := blockchain.DefaultChainStoreEx.GetSpentBy(txid, uint16(index))
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	if !found {
+		return ResponsePack(Success, nil)
+	}
+	return ResponsePack(Success, SpentByInfo{
+		TxID:   ToReversedString(spent.Txid),
+		VIn:    spent.Index,
+		Height: spent.Height,
+	})
+}
+
+// AddWebhook registers a callback url posted the new history of addresses.
+// The response holds the secret the payloads are signed with. Payloads are
+// delivered at least once: the rows of a block are posted again after it
+// is rolled back and indexed again.
+func AddWebhook(param Params) map[string]interface{} {
+	callback, ok := param.String("url")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	addrs, errCode := getAddresses(param, webhook.MaxAddresses)
+	if errCode != Success {
+		return ResponsePack(errCode, "")
+	}
+	watch, err := webhook.DefaultDispatcher.AddWatch(callback, addrs,
+		blockchain.DefaultChainStoreEx.GetHeight())
+	if err != nil {
+		return ResponsePack(InvalidParams, err.Error())
+	}
+	return ResponsePack(Success, watch)
+}
+
+// GetWebhooks returns the registered webhooks without their secrets.
+func GetWebhooks(param Params) map[string]interface{} {
+	return ResponsePack(Success, webhook.DefaultDispatcher.Watches())
+}
+
+// RemoveWebhook deletes a webhook along with its undelivered payloads.
+func RemoveWebhook(param Params) map[string]interface{} {
+	id, ok := param.String("id")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	found, err := webhook.DefaultDispatcher.RemoveWatch(id)
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	if !found {
+		return ResponsePack(InvalidParams, "unknown webhook")
+	}
+	return ResponsePack(Success, id)
+}
+
+// GetWebhookDeadLetters returns the payloads given up on after failing
+// every attempt.
+func GetWebhookDeadLetters(param Params) map[string]interface{} {
+	deliveries, err := webhook.DefaultDispatcher.DeadLetters()
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	return ResponsePack(Success, deliveries)
+}
+
+// GetIndexStatus returns how far the history index is behind the chain and
+// the blocks waiting in its work log.
+func GetIndexStatus(param Params) map[string]interface{} {
+	return ResponsePack(Success, blockchain.DefaultChainStoreEx.GetIndexLag())
+}
+
+// GetOutputCacheStats returns the hit rate of the cache resolving the
+// outputs spent by the blocks being indexed.
+func GetOutputCacheStats(param Params) map[string]interface{} {
+	return ResponsePack(Success, blockchain.DefaultChainStoreEx.GetOutputCacheStats())
+}
+
+// VerifyIndex starts a check of the history index against the chain,
+// re-indexing the inconsistent heights when repair is set. The outcome is
+// read with GetIndexVerification.
+func VerifyIndex(param Params) map[string]interface{} {
+	repair, _ := param.Bool("repair")
+	if !blockchain.DefaultChainStoreEx.StartVerify(repair) {
+		return ResponsePack(InvalidParams, "a verification is already running")
+	}
+	return ResponsePack(Success, IndexVerifyInfo{Running: true})
+}
+
+// GetIndexVerification returns the report of the last index verification.
+func GetIndexVerification(param Params) map[string]interface{} {
+	report, running := blockchain.DefaultChainStoreEx.GetVerifyReport()
+	return ResponsePack(Success, IndexVerifyInfo{Running: running, Report: report})
+}
+
+// GetIndexQuarantine returns the blocks left out of the history index after
+// failing to be indexed.
+func GetIndexQuarantine(param Params) map[string]interface{} {
+	blocks, err := blockchain.DefaultChainStoreEx.GetQuarantine()
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	return ResponsePack(Success, blocks)
+}
+
+// RetryIndexQuarantine queues a quarantined block to be indexed again along
+// with every block above it.
+func RetryIndexQuarantine(param Params) map[string]interface{} {
+	height, ok := param.Uint("height")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	found, err := blockchain.DefaultChainStoreEx.RetryQuarantined(height)
+	if err != nil {
+		return ResponsePack(InternalError, err.Error())
+	}
+	if !found {
+		return ResponsePack(InvalidParams, "block not quarantined")
+	}
+	return ResponsePack(Success, height)
+}
+
+func getBalanceAtInfo(addr string, snapshot *blockchain.BalanceSnapshot, found bool) BalanceAtInfo {
+	info := BalanceAtInfo{Address: addr, Balance: common.Fixed64(0).String()}
+	if found {
+		lastChange := getBalanceSnapshotInfo(snapshot)
+		info.Balance = lastChange.Balance
+		info.LastChange = &lastChange
+	}
+	return info
+}
+
+// quarantinedUpTo returns the quarantined heights, lowest first, at or below
+// a height.
+func quarantinedUpTo(heights []uint32, height uint32) []uint32 {
+	for i, h := range heights {
+		if h > height {
+			return heights[:i]
+		}
+	}
+	return heights
+}
+
+func getBalanceSnapshotInfo(snapshot *blockchain.BalanceSnapshot) BalanceSnapshotInfo {
+	return BalanceSnapshotInfo{
+		Height:  snapshot.Height,
+		Time:    snapshot.CreateTime,
+		Balance: common.Fixed64(snapshot.Balance).String(),
+	}
+}
+
 func GetFeeRate(count int, confirm int) int {
 	gap := count - confirm
 	if gap < 0 {
@@ -1272,6 +2005,7 @@ func VerifyAndSendTx(txn *Transaction) ErrCode {
 		log.Info("[httpjsonrpc] VerifyTransaction failed when AppendToTxnPool. Errcode:", errCode)
 		return errCode
 	}
+	blockchain.DefaultChainStoreEx.OnTxPoolChanged()
 	if err := ServerNode.Relay(nil, txn); err != nil {
 		log.Error("Xmit Tx Error:Relay transaction failed.", err)
 		return ErrXmitFail
@@ -0,0 +1,119 @@
+package servers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/errors"
+)
+
+// historyChainStore serves the same rows as the history of every address.
+type historyChainStore struct {
+	blockchain.IChainStoreExtend
+	rows types.TransactionHistorySorter
+}
+
+func (s *historyChainStore) GetTxHistory(addr string) types.TransactionHistorySorter {
+	return s.rows
+}
+
+func Test_GetUnit(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   Params
+		inEla   bool
+		errCode errors.ErrCode
+	}{
+		{"no unit", Params{}, false, errors.Success},
+		{"ela", Params{"unit": "ela"}, true, errors.Success},
+		{"sela", Params{"unit": "sela"}, false, errors.Success},
+		{"upper case", Params{"unit": "ELA"}, false, errors.InvalidParams},
+		{"unknown", Params{"unit": "btc"}, false, errors.InvalidParams},
+		{"empty", Params{"unit": ""}, false, errors.InvalidParams},
+	}
+	for _, test := range tests {
+		inEla, errCode := getUnit(test.param)
+		if inEla != test.inEla || errCode != test.errCode {
+			t.Errorf("%s: expect %v %v, got %v %v", test.name, test.inEla, test.errCode, inEla, errCode)
+		}
+	}
+}
+
+func Test_GetTxHistoryInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		txh   types.TransactionHistory
+		value string
+		fee   string
+	}{
+		{"zero", types.TransactionHistory{}, "0.00000000", "0.00000000"},
+		{"one sela", types.TransactionHistory{Value: 1, Fee: 1}, "0.00000001", "0.00000001"},
+		{"one ela", types.TransactionHistory{Value: 100000000, Fee: 100}, "1.00000000", "0.00000100"},
+		{"fraction", types.TransactionHistory{Value: 1234567891, Fee: 10000}, "12.34567891", "0.00010000"},
+	}
+	for _, test := range tests {
+		info := getTxHistoryInfo(&test.txh)
+		if info.Value != test.value || info.Fee != test.fee {
+			t.Errorf("%s: expect value %s fee %s, got %s %s", test.name, test.value, test.fee, info.Value, info.Fee)
+		}
+	}
+
+	txh := types.TransactionHistory{
+		Address: "EAddr", Txid: "01", Type: "spend", Height: 3, CreateTime: 1500000000,
+		Inputs: []string{"EAddr"}, Outputs: []string{"EOther"}, TxType: "TransferCrossChainAsset",
+		CrossChainAmounts: []uint64{50000000, 7}, DepositAmount: 500000000000,
+		Status: types.TxStatusPending,
+	}
+	info := getTxHistoryInfo(&txh)
+	if expect := []string{"0.50000000", "0.00000007"}; !reflect.DeepEqual(info.CrossChainAmounts, expect) {
+		t.Errorf("expect cross chain amounts %v, got %v", expect, info.CrossChainAmounts)
+	}
+	if info.DepositAmount != "5000.00000000" {
+		t.Errorf("expect deposit 5000.00000000, got %s", info.DepositAmount)
+	}
+	if info.Address != txh.Address || info.Height != txh.Height || info.Status != txh.Status ||
+		!reflect.DeepEqual(info.Outputs, txh.Outputs) {
+		t.Errorf("expect the other fields copied, got %+v", info)
+	}
+	if infos := getTxHistoryInfos(nil); infos == nil || len(infos) != 0 {
+		t.Errorf("expect an empty list, got %v", infos)
+	}
+}
+
+func Test_GetHistoryUnit(t *testing.T) {
+	defer func(c blockchain.IChainStoreExtend) { blockchain.DefaultChainStoreEx = c }(blockchain.DefaultChainStoreEx)
+	rows := types.TransactionHistorySorter{{Address: "EAddr", Txid: "01", Value: 150000000, Fee: 100}}
+	blockchain.DefaultChainStoreEx = &historyChainStore{rows: rows}
+	addr, err := common.Uint168{0x21, 1}.ToAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		param   Params
+		errCode errors.ErrCode
+		result  interface{}
+	}{
+		{"sela by default", Params{"addr": addr}, errors.Success, rows},
+		{"sela", Params{"addr": addr, "unit": "sela"}, errors.Success, rows},
+		{"ela", Params{"addr": addr, "unit": "ela"}, errors.Success, []TxHistoryInfo{getTxHistoryInfo(&rows[0])}},
+		{"invalid unit", Params{"addr": addr, "unit": "mela"}, errors.InvalidParams, nil},
+	}
+	for _, test := range tests {
+		resp := GetHistory(test.param)
+		if resp["Error"] != test.errCode {
+			t.Errorf("%s: expect error %v, got %v", test.name, test.errCode, resp["Error"])
+			continue
+		}
+		if test.errCode == errors.Success && !reflect.DeepEqual(resp["Result"], test.result) {
+			t.Errorf("%s: expect %+v, got %+v", test.name, test.result, resp["Result"])
+		}
+	}
+	if info := getTxHistoryInfo(&rows[0]); info.Value != "1.50000000" || info.Fee != "0.00000100" {
+		t.Errorf("expect amounts in ela, got %s %s", info.Value, info.Fee)
+	}
+}
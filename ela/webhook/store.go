@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
+	. "github.com/elastos/Elastos.ELA/blockchain"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Store is the part of the ext store webhooks keep their state in. Writes
+// go straight to the store, the batch belongs to the indexing loop: the
+// outbox entries of a block, the sequence and the queued heights are
+// handed to it by the loop.
+type Store interface {
+	Put(key []byte, value []byte) error
+	Get(key []byte) ([]byte, error)
+	Delete(key []byte) error
+	NewIterator(prefix []byte) IIterator
+}
+
+// Watch sends the history of a set of addresses to a callback url. Rows at
+// or below FromHeight, the chain height when the watch was added, are not
+// sent so rebuilding the index does not replay them. Rows of the blocks
+// indexed again after that are skipped with the queued height of the
+// watch.
+type Watch struct {
+	ID         string   `json:"id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	Addresses  []string `json:"addresses"`
+	FromHeight uint32   `json:"fromheight"`
+}
+
+func (w *Watch) Serialize(wr io.Writer) error {
+	for _, s := range []string{w.ID, w.URL, w.Secret} {
+		if err := common.WriteVarString(wr, s); err != nil {
+			return err
+		}
+	}
+	if err := common.WriteVarUint(wr, uint64(len(w.Addresses))); err != nil {
+		return err
+	}
+	for _, address := range w.Addresses {
+		if err := common.WriteVarString(wr, address); err != nil {
+			return err
+		}
+	}
+	return common.WriteUint32(wr, w.FromHeight)
+}
+
+func (w *Watch) Deserialize(r io.Reader) error {
+	var err error
+	for _, s := range []*string{&w.ID, &w.URL, &w.Secret} {
+		if *s, err = common.ReadVarString(r); err != nil {
+			return err
+		}
+	}
+	n, err := common.ReadVarUint(r, 0)
+	if err != nil {
+		return err
+	}
+	w.Addresses = make([]string, 0, n)
+	for i := uint64(0); i < n; i++ {
+		address, err := common.ReadVarString(r)
+		if err != nil {
+			return err
+		}
+		w.Addresses = append(w.Addresses, address)
+	}
+	w.FromHeight, err = common.ReadUint32(r)
+	return err
+}
+
+// Delivery is a payload waiting in the outbox to be posted to the url of a
+// watch, or given up on and kept as a dead letter.
+type Delivery struct {
+	Seq         uint64 `json:"seq"`
+	WatchID     string `json:"watchid"`
+	URL         string `json:"url"`
+	Payload     string `json:"payload"`
+	Attempts    uint32 `json:"attempts"`
+	NextAttempt int64  `json:"nextattempt"`
+	LastError   string `json:"lasterror"`
+}
+
+func (d *Delivery) Serialize(w io.Writer) error {
+	if err := common.WriteUint64(w, d.Seq); err != nil {
+		return err
+	}
+	for _, s := range []string{d.WatchID, d.URL, d.Payload} {
+		if err := common.WriteVarString(w, s); err != nil {
+			return err
+		}
+	}
+	if err := common.WriteUint32(w, d.Attempts); err != nil {
+		return err
+	}
+	if err := common.WriteUint64(w, uint64(d.NextAttempt)); err != nil {
+		return err
+	}
+	return common.WriteVarString(w, d.LastError)
+}
+
+func (d *Delivery) Deserialize(r io.Reader) error {
+	var err error
+	if d.Seq, err = common.ReadUint64(r); err != nil {
+		return err
+	}
+	for _, s := range []*string{&d.WatchID, &d.URL, &d.Payload} {
+		if *s, err = common.ReadVarString(r); err != nil {
+			return err
+		}
+	}
+	if d.Attempts, err = common.ReadUint32(r); err != nil {
+		return err
+	}
+	next, err := common.ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	d.NextAttempt = int64(next)
+	d.LastError, err = common.ReadVarString(r)
+	return err
+}
+
+// key: DataWebhookPrefix + id
+func watchKey(id string) []byte {
+	return append([]byte{byte(blockchain.DataWebhookPrefix)}, id...)
+}
+
+// key: DataWebhookOutboxPrefix or DataWebhookDeadLetterPrefix + seq, big
+// endian so deliveries are iterated in the order they were queued
+func deliveryKey(prefix DataEntryPrefix, seq uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = byte(prefix)
+	binary.BigEndian.PutUint64(key[1:], seq)
+	return key
+}
+
+func putWatch(store Store, w *Watch) error {
+	value := new(bytes.Buffer)
+	if err := w.Serialize(value); err != nil {
+		return err
+	}
+	return store.Put(watchKey(w.ID), value.Bytes())
+}
+
+func loadWatches(store Store) (map[string]*Watch, error) {
+	iter := store.NewIterator([]byte{byte(blockchain.DataWebhookPrefix)})
+	defer iter.Release()
+	watches := make(map[string]*Watch)
+	for iter.Next() {
+		w := new(Watch)
+		if err := w.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+			return nil, err
+		}
+		watches[w.ID] = w
+	}
+	return watches, nil
+}
+
+func putDelivery(store Store, prefix DataEntryPrefix, d *Delivery) error {
+	value := new(bytes.Buffer)
+	if err := d.Serialize(value); err != nil {
+		return err
+	}
+	return store.Put(deliveryKey(prefix, d.Seq), value.Bytes())
+}
+
+func loadDeliveries(store Store, prefix DataEntryPrefix) ([]Delivery, error) {
+	iter := store.NewIterator([]byte{byte(prefix)})
+	defer iter.Release()
+	var deliveries []Delivery
+	for iter.Next() {
+		var d Delivery
+		if err := d.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// key: DataWebhookStatePrefix
+// value: sequence number of the last delivery queued
+func seqKey() []byte {
+	return []byte{byte(blockchain.DataWebhookStatePrefix)}
+}
+
+// key: DataWebhookStatePrefix + watch id
+// value: height of the next block whose rows are queued for the watch
+func queuedKey(id string) []byte {
+	return append(seqKey(), id...)
+}
+
+func encodeSeq(seq uint64) []byte {
+	value := new(bytes.Buffer)
+	common.WriteUint64(value, seq)
+	return value.Bytes()
+}
+
+func encodeHeight(height uint32) []byte {
+	value := new(bytes.Buffer)
+	common.WriteUint32(value, height)
+	return value.Bytes()
+}
+
+// loadQueued returns the next height to queue of every watch that had rows
+// queued.
+func loadQueued(store Store, watches map[string]*Watch) (map[string]uint32, error) {
+	queued := make(map[string]uint32)
+	for id := range watches {
+		data, err := store.Get(queuedKey(id))
+		if err == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if queued[id], err = common.ReadUint32(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	}
+	return queued, nil
+}
+
+// lastSeq returns the highest sequence number queued so far. Stores written
+// before the sequence was kept only have it in the outbox and the dead
+// letters.
+func lastSeq(store Store) (uint64, error) {
+	var seq uint64
+	data, err := store.Get(seqKey())
+	if err == nil {
+		if seq, err = common.ReadUint64(bytes.NewReader(data)); err != nil {
+			return 0, err
+		}
+	} else if err != leveldb.ErrNotFound {
+		return 0, err
+	}
+	for _, prefix := range []DataEntryPrefix{blockchain.DataWebhookOutboxPrefix,
+		blockchain.DataWebhookDeadLetterPrefix} {
+		iter := store.NewIterator([]byte{byte(prefix)})
+		if iter.Last() {
+			if s := binary.BigEndian.Uint64(iter.Key()[1:]); s > seq {
+				seq = s
+			}
+		}
+		iter.Release()
+	}
+	return seq, nil
+}
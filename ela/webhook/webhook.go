@@ -0,0 +1,387 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	"github.com/elastos/Elastos.ELA/common/log"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the body, keyed with
+	// the secret of the watch.
+	SignatureHeader = "X-Elephant-Signature"
+	// DeliveryHeader carries the sequence number of the delivery, the same
+	// on every attempt and never reused across restarts.
+	DeliveryHeader = "X-Elephant-Delivery"
+
+	// MaxAttempts is the number of times a delivery is tried before it is
+	// moved to the dead letters.
+	MaxAttempts = 8
+	// MaxAddresses is the largest number of addresses a watch may have.
+	MaxAddresses = 1000
+
+	baseDelay    = 5 * time.Second
+	maxDelay     = time.Hour
+	pollInterval = time.Second
+	postTimeout  = 10 * time.Second
+)
+
+var DefaultDispatcher *Dispatcher
+
+// Payload is the body posted to the url of a watch.
+type Payload struct {
+	Watch   string                     `json:"watch"`
+	Seq     uint64                     `json:"seq"`
+	History []types.TransactionHistory `json:"history"`
+}
+
+// Dispatcher queues the new history rows of watched addresses in the
+// outbox and posts them to the url of their watch, retrying failed
+// deliveries with an exponential backoff. Deliveries are posted one at a
+// time by a single goroutine, apart from the indexing loop.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.RWMutex
+	watches map[string]*Watch
+	seq     uint64
+	// queued is the next height whose rows are queued for a watch, staged
+	// the heights written to the batch of a block until it is committed.
+	queued map[string]uint32
+	staged map[string]uint32
+
+	wake chan struct{}
+	quit chan struct{}
+}
+
+// NewDispatcher loads the watches and the outbox from the store.
+func NewDispatcher(store Store) (*Dispatcher, error) {
+	watches, err := loadWatches(store)
+	if err != nil {
+		return nil, err
+	}
+	queued, err := loadQueued(store, watches)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := lastSeq(store)
+	if err != nil {
+		return nil, err
+	}
+	return &Dispatcher{
+		store:   store,
+		client:  &http.Client{Timeout: postTimeout},
+		now:     time.Now,
+		watches: watches,
+		seq:     seq,
+		queued:  queued,
+		wake:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}, nil
+}
+
+// Start delivers the outbox in the background until Stop is called.
+func (d *Dispatcher) Start() {
+	go d.loop()
+}
+
+func (d *Dispatcher) Stop() {
+	close(d.quit)
+}
+
+func (d *Dispatcher) loop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		case <-d.quit:
+			return
+		}
+		if err := d.deliverDue(); err != nil {
+			log.Error("webhook outbox: ", err)
+		}
+	}
+}
+
+// AddWatch registers a callback url for the history of addresses and
+// returns the watch with the secret its payloads are signed with.
+func (d *Dispatcher) AddWatch(callback string, addresses []string, fromHeight uint32) (*Watch, error) {
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("invalid callback url")
+	}
+	if len(addresses) == 0 || len(addresses) > MaxAddresses {
+		return nil, errors.New("invalid addresses")
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watch{
+		ID:         id,
+		URL:        callback,
+		Secret:     secret,
+		Addresses:  addresses,
+		FromHeight: fromHeight,
+	}
+	if err := putWatch(d.store, w); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.watches[id] = w
+	d.mu.Unlock()
+	return w, nil
+}
+
+// RemoveWatch deletes a watch and reports whether it existed. Deliveries
+// still queued for it are dropped.
+func (d *Dispatcher) RemoveWatch(id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.watches[id]; !ok {
+		return false, nil
+	}
+	if err := d.store.Delete(watchKey(id)); err != nil {
+		return false, err
+	}
+	if err := d.store.Delete(queuedKey(id)); err != nil {
+		return false, err
+	}
+	delete(d.watches, id)
+	delete(d.queued, id)
+	return true, nil
+}
+
+// Watches returns every watch, without their secrets.
+func (d *Dispatcher) Watches() []Watch {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	watches := make([]Watch, 0, len(d.watches))
+	for _, w := range d.watches {
+		watch := *w
+		watch.Secret = ""
+		watches = append(watches, watch)
+	}
+	return watches
+}
+
+// DeadLetters returns the deliveries given up on, oldest first.
+func (d *Dispatcher) DeadLetters() ([]Delivery, error) {
+	return loadDeliveries(d.store, blockchain.DataWebhookDeadLetterPrefix)
+}
+
+// BatchTxHistory queues one payload per watch with the confirmed rows of
+// its addresses, in the batch storing the rows of their block. A payload is
+// in the outbox if and only if its rows are indexed. A block indexed again,
+// by a reindex or after a crash, is not queued twice for a watch: the
+// height of the next block to queue is kept per watch in the same batch,
+// and only moved back by a rollback.
+func (d *Dispatcher) BatchTxHistory(batch blockchain.HistoryBatch, txhs []types.TransactionHistory) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	height := uint32(txhs[0].Height)
+	d.staged = make(map[string]uint32)
+	for _, w := range d.watches {
+		if next, ok := d.queued[w.ID]; ok && height < next {
+			continue
+		}
+		rows := w.match(txhs)
+		if len(rows) == 0 {
+			continue
+		}
+		d.seq++
+		body, err := json.Marshal(Payload{Watch: w.ID, Seq: d.seq, History: rows})
+		if err != nil {
+			log.Error("webhook payload: ", err)
+			continue
+		}
+		delivery := &Delivery{
+			Seq:         d.seq,
+			WatchID:     w.ID,
+			URL:         w.URL,
+			Payload:     string(body),
+			NextAttempt: d.now().Unix(),
+		}
+		value := new(bytes.Buffer)
+		if err := delivery.Serialize(value); err != nil {
+			log.Error("webhook outbox: ", err)
+			continue
+		}
+		batch.BatchPut(deliveryKey(blockchain.DataWebhookOutboxPrefix, delivery.Seq), value.Bytes())
+		batch.BatchPut(queuedKey(w.ID), encodeHeight(height+1))
+		d.staged[w.ID] = height + 1
+	}
+	if len(d.staged) > 0 {
+		batch.BatchPut(seqKey(), encodeSeq(d.seq))
+	}
+}
+
+// BatchRollback moves the queued height of the watches back to the first
+// block rolled back, so the rows of the blocks replacing them are queued.
+// Rows of a block indexed again after a rollback may be delivered twice,
+// receivers dedup them by txid and address.
+func (d *Dispatcher) BatchRollback(batch blockchain.HistoryBatch, height uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, next := range d.queued {
+		if next > height {
+			d.queued[id] = height
+			batch.BatchPut(queuedKey(id), encodeHeight(height))
+		}
+	}
+}
+
+// OnTxHistory wakes the delivery once the payloads queued for the rows of
+// a block are committed, and takes their queued heights.
+func (d *Dispatcher) OnTxHistory(txhs []types.TransactionHistory) {
+	for _, txh := range txhs {
+		if txh.Status != "" {
+			continue
+		}
+		d.mu.Lock()
+		for id, next := range d.staged {
+			if _, ok := d.watches[id]; ok {
+				d.queued[id] = next
+			}
+		}
+		d.staged = nil
+		d.mu.Unlock()
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+		return
+	}
+}
+
+func (w *Watch) match(txhs []types.TransactionHistory) []types.TransactionHistory {
+	var rows []types.TransactionHistory
+	for _, txh := range txhs {
+		if txh.Status != "" || txh.Height <= uint64(w.FromHeight) {
+			continue
+		}
+		for _, address := range w.Addresses {
+			if txh.Address == address {
+				rows = append(rows, txh)
+				break
+			}
+		}
+	}
+	return rows
+}
+
+// deliverDue attempts every delivery of the outbox whose time has come. It
+// only rewrites the deliveries it loaded, so payloads queued meanwhile are
+// left alone.
+func (d *Dispatcher) deliverDue() error {
+	deliveries, err := loadDeliveries(d.store, blockchain.DataWebhookOutboxPrefix)
+	if err != nil {
+		return err
+	}
+	now := d.now()
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		if delivery.NextAttempt > now.Unix() {
+			continue
+		}
+		d.mu.RLock()
+		w, ok := d.watches[delivery.WatchID]
+		d.mu.RUnlock()
+		if !ok {
+			err = d.store.Delete(deliveryKey(blockchain.DataWebhookOutboxPrefix, delivery.Seq))
+		} else if postErr := d.post(w, delivery); postErr == nil {
+			err = d.store.Delete(deliveryKey(blockchain.DataWebhookOutboxPrefix, delivery.Seq))
+		} else {
+			err = d.retry(delivery, postErr, now)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retry schedules the next attempt of a failed delivery, or moves it to the
+// dead letters once it has been tried MaxAttempts times.
+func (d *Dispatcher) retry(delivery *Delivery, postErr error, now time.Time) error {
+	delivery.Attempts++
+	delivery.LastError = postErr.Error()
+	if delivery.Attempts >= MaxAttempts {
+		log.Warnf("webhook delivery %d to %s failed %d times: %s", delivery.Seq,
+			delivery.URL, delivery.Attempts, postErr)
+		if err := putDelivery(d.store, blockchain.DataWebhookDeadLetterPrefix, delivery); err != nil {
+			return err
+		}
+		return d.store.Delete(deliveryKey(blockchain.DataWebhookOutboxPrefix, delivery.Seq))
+	}
+	delivery.NextAttempt = now.Add(backoff(delivery.Attempts)).Unix()
+	return putDelivery(d.store, blockchain.DataWebhookOutboxPrefix, delivery)
+}
+
+// backoff is the wait after a delivery failed a number of times.
+func backoff(attempts uint32) time.Duration {
+	delay := baseDelay << (attempts - 1)
+	if delay > maxDelay || delay <= 0 {
+		return maxDelay
+	}
+	return delay
+}
+
+func (d *Dispatcher) post(w *Watch, delivery *Delivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(w.Secret, []byte(delivery.Payload)))
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(delivery.Seq, 10))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature of a payload body sent with a secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
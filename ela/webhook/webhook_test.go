@@ -0,0 +1,272 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/blockchain"
+	"github.com/elastos/Elastos.ELA.Elephant.Node/ela/core/types"
+	. "github.com/elastos/Elastos.ELA/blockchain"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+type memStore struct {
+	db *leveldb.DB
+}
+
+func newMemStore(t *testing.T) *memStore {
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &memStore{db: db}
+}
+
+func (s *memStore) Put(key []byte, value []byte) error { return s.db.Put(key, value, nil) }
+func (s *memStore) Get(key []byte) ([]byte, error)     { return s.db.Get(key, nil) }
+func (s *memStore) Delete(key []byte) error            { return s.db.Delete(key, nil) }
+func (s *memStore) NewIterator(prefix []byte) IIterator {
+	return s.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+// callback is a stand-in for the server behind a webhook url.
+type callback struct {
+	sync.Mutex
+	status   int
+	payloads []Payload
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (c *callback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	var payload Payload
+	json.Unmarshal(body, &payload)
+	c.payloads = append(c.payloads, payload)
+	c.headers = append(c.headers, r.Header)
+	c.bodies = append(c.bodies, body)
+	w.WriteHeader(c.status)
+}
+
+// testBatch is the batch of the indexing loop.
+type testBatch struct {
+	batch *leveldb.Batch
+}
+
+func (b *testBatch) BatchPut(key []byte, value []byte) { b.batch.Put(key, value) }
+
+// queue hands rows to the dispatcher the way the indexing loop does, the
+// payloads written to a batch committed along with the rows.
+func queue(t *testing.T, d *Dispatcher, rows []types.TransactionHistory) {
+	before, _ := loadDeliveries(d.store, blockchain.DataWebhookOutboxPrefix)
+	batch := &testBatch{new(leveldb.Batch)}
+	d.BatchTxHistory(batch, rows)
+	if outbox, _ := loadDeliveries(d.store, blockchain.DataWebhookOutboxPrefix); len(outbox) != len(before) {
+		t.Fatalf("expect nothing queued before the batch is committed, got %+v", outbox)
+	}
+	if err := d.store.(*memStore).db.Write(batch.batch, nil); err != nil {
+		t.Fatal(err)
+	}
+	d.OnTxHistory(rows)
+}
+
+func testRows() []types.TransactionHistory {
+	return []types.TransactionHistory{
+		{Address: "EWatched", Txid: "01", Height: 5},
+		{Address: "EWatched", Txid: "02", Height: 6, Value: 100},
+		{Address: "EWatched", Txid: "03", Status: types.TxStatusPending},
+		{Address: "EOther", Txid: "04", Height: 6},
+	}
+}
+
+func Test_Deliver(t *testing.T) {
+	cb := &callback{status: http.StatusOK}
+	server := httptest.NewServer(cb)
+	defer server.Close()
+
+	d, err := NewDispatcher(newMemStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	watch, err := d.AddWatch(server.URL, []string{"EWatched"}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue(t, d, testRows())
+	if err := d.deliverDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cb.payloads) != 1 {
+		t.Fatalf("expect one delivery, got %d", len(cb.payloads))
+	}
+	payload := cb.payloads[0]
+	if payload.Watch != watch.ID || payload.Seq != 1 || len(payload.History) != 1 ||
+		payload.History[0].Txid != "02" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if sig := cb.headers[0].Get(SignatureHeader); sig != Sign(watch.Secret, cb.bodies[0]) {
+		t.Errorf("unexpected signature %s", sig)
+	}
+	if seq := cb.headers[0].Get(DeliveryHeader); seq != "1" {
+		t.Errorf("expect delivery 1, got %s", seq)
+	}
+	outbox, _ := loadDeliveries(d.store, blockchain.DataWebhookOutboxPrefix)
+	if len(outbox) != 0 {
+		t.Errorf("expect an empty outbox, got %+v", outbox)
+	}
+
+	// a restarted dispatcher goes on with the sequence once the outbox is
+	// empty
+	reloaded, err := NewDispatcher(d.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue(t, reloaded, []types.TransactionHistory{{Address: "EWatched", Txid: "05", Height: 7}})
+	if err := reloaded.deliverDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cb.payloads) != 2 || cb.headers[1].Get(DeliveryHeader) != "2" {
+		t.Errorf("expect delivery 2 after the restart, got %d payloads", len(cb.payloads))
+	}
+}
+
+func Test_QueueIndexedAgain(t *testing.T) {
+	store := newMemStore(t)
+	d, err := NewDispatcher(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.AddWatch("http://example.com", []string{"EWatched"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	block := func(height uint64) []types.TransactionHistory {
+		return []types.TransactionHistory{{Address: "EWatched", Txid: "01", Height: height}}
+	}
+	queue(t, d, block(1))
+	queue(t, d, block(2))
+
+	// a reindex from genesis hands the same blocks again
+	reloaded, err := NewDispatcher(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue(t, reloaded, block(1))
+	queue(t, reloaded, block(2))
+	if outbox, _ := loadDeliveries(store, blockchain.DataWebhookOutboxPrefix); len(outbox) != 2 {
+		t.Fatalf("expect the blocks queued once, got %+v", outbox)
+	}
+
+	// the block replacing a rolled back one is queued
+	batch := &testBatch{new(leveldb.Batch)}
+	reloaded.BatchRollback(batch, 2)
+	if err := store.db.Write(batch.batch, nil); err != nil {
+		t.Fatal(err)
+	}
+	queue(t, reloaded, block(2))
+	outbox, _ := loadDeliveries(store, blockchain.DataWebhookOutboxPrefix)
+	if len(outbox) != 3 || outbox[2].Seq != 3 {
+		t.Errorf("expect the replacing block queued as delivery 3, got %+v", outbox)
+	}
+}
+
+func Test_DeliverRetry(t *testing.T) {
+	cb := &callback{status: http.StatusInternalServerError}
+	server := httptest.NewServer(cb)
+	defer server.Close()
+
+	store := newMemStore(t)
+	d, err := NewDispatcher(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	d.now = func() time.Time { return now }
+	if _, err := d.AddWatch(server.URL, []string{"EWatched"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	queue(t, d, testRows())
+
+	for attempt := uint32(1); attempt < MaxAttempts; attempt++ {
+		if err := d.deliverDue(); err != nil {
+			t.Fatal(err)
+		}
+		outbox, _ := loadDeliveries(store, blockchain.DataWebhookOutboxPrefix)
+		if len(outbox) != 1 || outbox[0].Attempts != attempt ||
+			outbox[0].NextAttempt != now.Add(backoff(attempt)).Unix() {
+			t.Fatalf("unexpected outbox after attempt %d: %+v", attempt, outbox)
+		}
+		// nothing is due before the backoff elapses
+		if err := d.deliverDue(); err != nil {
+			t.Fatal(err)
+		}
+		if len(cb.payloads) != int(attempt) {
+			t.Fatalf("expect %d attempts, got %d", attempt, len(cb.payloads))
+		}
+		now = now.Add(backoff(attempt))
+	}
+	if err := d.deliverDue(); err != nil {
+		t.Fatal(err)
+	}
+	dead, err := d.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Attempts != MaxAttempts || dead[0].LastError != "status 500" {
+		t.Errorf("expect a dead letter, got %+v", dead)
+	}
+	outbox, _ := loadDeliveries(store, blockchain.DataWebhookOutboxPrefix)
+	if len(outbox) != 0 {
+		t.Errorf("expect an empty outbox, got %+v", outbox)
+	}
+
+	// a restarted dispatcher keeps the watches and the sequence
+	reloaded, err := NewDispatcher(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Watches()) != 1 || reloaded.seq != 1 {
+		t.Errorf("unexpected reloaded dispatcher %+v", reloaded)
+	}
+}
+
+func Test_RemoveWatch(t *testing.T) {
+	cb := &callback{status: http.StatusOK}
+	server := httptest.NewServer(cb)
+	defer server.Close()
+
+	d, err := NewDispatcher(newMemStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	watch, err := d.AddWatch(server.URL, []string{"EWatched"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.AddWatch("ftp://example.com", []string{"EWatched"}, 0); err == nil {
+		t.Error("expect a non http url to be refused")
+	}
+	queue(t, d, testRows())
+	if found, err := d.RemoveWatch(watch.ID); err != nil || !found {
+		t.Fatalf("expect the watch to be removed, got %v %v", found, err)
+	}
+	if err := d.deliverDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cb.payloads) != 0 {
+		t.Errorf("expect no delivery for a removed watch, got %+v", cb.payloads)
+	}
+	outbox, _ := loadDeliveries(d.store, blockchain.DataWebhookOutboxPrefix)
+	if len(outbox) != 0 {
+		t.Errorf("expect the outbox to be dropped, got %+v", outbox)
+	}
+}
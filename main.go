@@ -1,12 +1,15 @@
 package main
 
 import (
+	"flag"
+
 	"github.com/elastos/Elastos.ELA.Elephant.Node/ela"
 	"github.com/elastos/Elastos.ELA.Elephant.Node/id"
 	"github.com/elastos/Elastos.ELA.Utility/signal"
 )
 
 func main() {
+	flag.Parse()
 	var interrupt = signal.NewInterrupt()
 	go ela.Go()
 	go id.Go()